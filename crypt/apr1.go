@@ -0,0 +1,109 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypt
+
+import (
+	"crypto/md5"
+)
+
+const (
+	// Defines the prefix of password hashes generated by APR1.
+	APR1_PREFIX = "$apr1$"
+	// Defines the maximum length of APR1 salt.
+	APR1_MAX_SALT_SIZE = 8
+)
+
+// apr1Alphabet defines the characters of encoded APR1 hashes.
+const apr1Alphabet = "./0123456789" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// APR1 hashes specified secret using specified salt, as defined by the
+// MD5-based algorithm of Apache htpasswd. The salt is truncated to
+// APR1_MAX_SALT_SIZE characters. Returns the hash prefixed by APR1_PREFIX and
+// salt, as stored by htpasswd files.
+//
+// The MD5-based algorithm is weak, it should be used only to verify existing
+// hashes.
+func APR1(secret, salt string) string {
+	if len(salt) > APR1_MAX_SALT_SIZE {
+		salt = salt[:APR1_MAX_SALT_SIZE]
+	}
+	pw := []byte(secret)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(APR1_PREFIX))
+	ctx.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= md5.Size {
+		if i > md5.Size {
+			ctx.Write(altSum)
+		} else {
+			ctx.Write(altSum[:i])
+		}
+	}
+	for i := len(pw); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	sum := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(sum)
+		} else {
+			round.Write(pw)
+		}
+		sum = round.Sum(nil)
+	}
+
+	out := make([]byte, 0, 22)
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			out = append(out, apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{
+		{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5},
+	} {
+		encode(uint(sum[g[0]])<<16|uint(sum[g[1]])<<8|uint(sum[g[2]]), 4)
+	}
+	encode(uint(sum[11]), 2)
+
+	return APR1_PREFIX + salt + "$" + string(out)
+}
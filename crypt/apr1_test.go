@@ -0,0 +1,41 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypt
+
+import (
+	"testing"
+)
+
+func TestAPR1(t *testing.T) {
+	testValues := []struct {
+		secret   string
+		salt     string
+		expected string
+	}{
+		{"myPassword", "r31..G..", "$apr1$r31..G..$QRSLA7/Hn4IAL5Ls3Zy111"},
+		{"", "saltsalt", "$apr1$saltsalt$a8ml/vK5HEjiZ5oypDWA7/"},
+		{"a very long password exceeding sixteen bytes", "abcdefghij",
+			"$apr1$abcdefgh$uwI1faKIAQ14oPo2mF5RU/"},
+	}
+
+	for _, v := range testValues {
+		if hash := APR1(v.secret, v.salt); hash != v.expected {
+			t.Errorf("The APR1 hash of '%s' should be %s, got %s",
+				v.secret, v.expected, hash)
+		}
+	}
+}
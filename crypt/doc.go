@@ -17,6 +17,18 @@
 /*
 Package crypt provides some cryptographic operations.
 
+APR1
+
+The 'APR1()' function hashes passwords by the MD5-based algorithm of Apache
+htpasswd files. It is weak, then it should be used only to verify existing
+hashes.
+
+Keyring
+
+A Keyring provides authenticated encryption by AES-256-GCM using keys derived
+from secrets by 'DeriveKey()' (HKDF-SHA256). Calling 'Rotate()' adds a new key
+to encrypt new data, while previous keys still decrypt existing data.
+
 Random
 
 A Random provides a pseudo-random generator based on syscall time deltas of
@@ -27,5 +39,12 @@ Salter
 A Salter provides a random data generator to password salt and unique session
 IDs. Every token generated is used to salt next token to increase
 unpredictability of generated data.
+
+TokenGenerator
+
+A TokenGenerator generates unique tokens, e.g. to identify user sessions. The
+available generators are Salter, random (v4) and time-ordered (v7) UUIDs,
+ULIDs and SignedTokenGenerator, whose tokens carry their issue time and are
+signed by HMAC-SHA256, then they can be verified without a lookup.
 */
 package crypt
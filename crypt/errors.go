@@ -0,0 +1,41 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypt
+
+import (
+	"fmt"
+)
+
+// An InvalidTokenError represents an error when a signed token is malformed or
+// its signature does not match.
+type InvalidTokenError string
+
+// Error returns string representation of current instance error.
+func (e InvalidTokenError) Error() string {
+	return fmt.Sprintf(
+		"Could not verify the '%s' token because it is malformed or forged",
+		string(e))
+}
+
+// A DecryptionError represents an error when sealed data could not be
+// decrypted, where its value describes the reason.
+type DecryptionError string
+
+// Error returns string representation of current instance error.
+func (e DecryptionError) Error() string {
+	return fmt.Sprintf("Could not decrypt the data: %s", string(e))
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// DeriveKey derives a key of specified size from a secret, as defined by
+// HKDF-SHA256 (RFC 5869). The salt is optional and info binds the key to its
+// purpose, then distinct keys are derived from the same secret for distinct
+// purposes.
+func DeriveKey(secret, salt []byte, info string, size int) []byte {
+	if len(salt) == 0 {
+		salt = make([]byte, sha256.Size)
+	}
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	key := make([]byte, 0, size+sha256.Size)
+	var block []byte
+	for counter := byte(1); len(key) < size; counter++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(block)
+		expand.Write([]byte(info))
+		expand.Write([]byte{counter})
+		block = expand.Sum(nil)
+		key = append(key, block...)
+	}
+	return key[:size]
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"sync"
+)
+
+const (
+	// Defines the purpose of keys derived by Keyring.
+	KEYRING_KEY_INFO = "raiqub keyring aes-256-gcm"
+	// Defines the length of key IDs prefixed to data sealed by Keyring.
+	KEYRING_ID_SIZE = 4
+)
+
+// A Keyring provides authenticated encryption by AES-256-GCM using keys
+// derived from secrets (see DeriveKey). The newest key encrypts new data, while
+// older keys are kept to decrypt data sealed before a key rotation. It is safe
+// for concurrent use.
+type Keyring struct {
+	keys []keyringEntry
+	sync.RWMutex
+}
+
+// A keyringEntry represents a key of a Keyring.
+type keyringEntry struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+// NewKeyring creates a new instance of Keyring that encrypts using the key
+// derived from secret, and optionally decrypts using keys derived from
+// previous secrets.
+func NewKeyring(secret []byte, previous ...[]byte) *Keyring {
+	k := &Keyring{}
+	for i := len(previous) - 1; i >= 0; i-- {
+		k.Rotate(previous[i])
+	}
+	k.Rotate(secret)
+	return k
+}
+
+// Open decrypts and authenticates data sealed by Seal, using the key that
+// sealed it.
+//
+// Errors:
+// DecryptionError when data is malformed, forged or sealed by an unknown key.
+func (self *Keyring) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < KEYRING_ID_SIZE {
+		return nil, DecryptionError("malformed data")
+	}
+
+	self.RLock()
+	defer self.RUnlock()
+
+	id := sealed[:KEYRING_ID_SIZE]
+	for _, k := range self.keys {
+		if string(k.id) != string(id) {
+			continue
+		}
+
+		nonceSize := k.aead.NonceSize()
+		if len(sealed) < KEYRING_ID_SIZE+nonceSize {
+			return nil, DecryptionError("malformed data")
+		}
+		nonce := sealed[KEYRING_ID_SIZE : KEYRING_ID_SIZE+nonceSize]
+		plaintext, err := k.aead.Open(nil, nonce,
+			sealed[KEYRING_ID_SIZE+nonceSize:], id)
+		if err != nil {
+			return nil, DecryptionError("authentication failed")
+		}
+		return plaintext, nil
+	}
+	return nil, DecryptionError("unknown key")
+}
+
+// Rotate adds the key derived from specified secret, which is used to encrypt
+// new data. The previous keys are kept to decrypt existing data.
+func (self *Keyring) Rotate(secret []byte) {
+	key := DeriveKey(secret, nil, KEYRING_KEY_INFO, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(key)
+
+	self.Lock()
+	defer self.Unlock()
+	self.keys = append([]keyringEntry{{sum[:KEYRING_ID_SIZE], aead}},
+		self.keys...)
+}
+
+// Seal encrypts and authenticates specified data using the newest key. The
+// sealed data is prefixed by the ID of the key and a random nonce.
+func (self *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	self.RLock()
+	k := self.keys[0]
+	self.RUnlock()
+
+	nonceSize := k.aead.NonceSize()
+	sealed := make([]byte, KEYRING_ID_SIZE+nonceSize,
+		KEYRING_ID_SIZE+nonceSize+len(plaintext)+k.aead.Overhead())
+	copy(sealed, k.id)
+	if _, err := io.ReadFull(rand.Reader, sealed[KEYRING_ID_SIZE:]); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(sealed, sealed[KEYRING_ID_SIZE:], plaintext, k.id), nil
+}
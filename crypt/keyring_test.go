@@ -0,0 +1,69 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// Test case 1 of RFC 5869
+	secret, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	expected := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db0" +
+		"2d56ecc4c5bf34007208d5b887185865"
+
+	key := DeriveKey(secret, salt, string(info), 42)
+	if hex.EncodeToString(key) != expected {
+		t.Errorf("The derived key should be %s, got %x", expected, key)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	plaintext := []byte("session data")
+	old := NewKeyring([]byte("old secret"))
+	sealed, err := old.Seal(plaintext)
+	if err != nil {
+		t.Fatalf("The data could not be sealed: %v", err)
+	}
+
+	k := NewKeyring([]byte("new secret"), []byte("old secret"))
+	if opened, err := k.Open(sealed); err != nil ||
+		!bytes.Equal(opened, plaintext) {
+		t.Errorf("The data sealed by previous key should be opened: %v", err)
+	}
+
+	resealed, _ := k.Seal(plaintext)
+	if _, err := old.Open(resealed); err == nil {
+		t.Error("The data sealed by newest key should not be opened by old key")
+	}
+	old.Rotate([]byte("new secret"))
+	if _, err := old.Open(resealed); err != nil {
+		t.Errorf("The data should be opened after key rotation: %v", err)
+	}
+
+	resealed[len(resealed)-1] ^= 1
+	if _, err := k.Open(resealed); err == nil {
+		t.Error("The forged data should not be opened")
+	}
+	if _, err := k.Open([]byte{1, 2}); err == nil {
+		t.Error("The malformed data should not be opened")
+	}
+}
@@ -23,14 +23,16 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"io"
+	"sync"
 )
 
 // A Salter provides a random data generator to password salt and unique session
-// IDs.
+// IDs. It is safe for concurrent use.
 type Salter struct {
 	salt       []byte
 	rndSources RandomSourceList
 	sumWeight  int
+	mutex      sync.Mutex
 }
 
 // NewSalter creates a new instance of Salter. It requires a list of sources of
@@ -58,6 +60,8 @@ func NewSalter(sources RandomSourceList, input []byte) *Salter {
 // BToken generates an array of random bytes with length as specified by size
 // parameter.
 func (self *Salter) BToken(size int) []byte {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
 	mac := hmac.New(sha256.New, self.salt)
 
 	for _, v := range self.rndSources {
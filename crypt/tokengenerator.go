@@ -0,0 +1,134 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"time"
+)
+
+const (
+	// Defines the alphabet used to encode ULIDs (Crockford's Base32).
+	ULID_ALPHABET = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// A TokenGenerator defines a generator of unique tokens, e.g. to identify user
+// sessions.
+type TokenGenerator interface {
+	// NewToken generates a new unique token.
+	NewToken() (string, error)
+}
+
+// NewToken generates a new base-64 token of random bytes with default length.
+// It implements TokenGenerator interface.
+func (self *Salter) NewToken() (string, error) {
+	return self.DefaultToken(), nil
+}
+
+// A uuidGenerator represents a TokenGenerator of random UUIDs, optionally
+// prefixed by timestamp.
+type uuidGenerator struct {
+	version byte
+	now     func() time.Time
+}
+
+// NewUUIDv4Generator creates a new TokenGenerator of random UUIDs (version 4),
+// as defined by RFC 9562.
+func NewUUIDv4Generator() TokenGenerator {
+	return &uuidGenerator{version: 4}
+}
+
+// NewUUIDv7Generator creates a new TokenGenerator of time-ordered UUIDs
+// (version 7), as defined by RFC 9562. The UUIDs start with the milliseconds
+// since Unix epoch returned by now, or by system time when now is nil.
+func NewUUIDv7Generator(now func() time.Time) TokenGenerator {
+	if now == nil {
+		now = time.Now
+	}
+	return &uuidGenerator{version: 7, now: now}
+}
+
+// NewToken generates a new UUID in its canonical textual representation.
+func (self *uuidGenerator) NewToken() (string, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		return "", err
+	}
+
+	if self.version == 7 {
+		ms := uint64(self.now().UnixMilli())
+		binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+		binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	}
+	b[6] = b[6]&0x0f | self.version<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:]), nil
+}
+
+// A ulidGenerator represents a TokenGenerator of ULIDs.
+type ulidGenerator struct {
+	now func() time.Time
+}
+
+// NewULIDGenerator creates a new TokenGenerator of ULIDs, which are 26
+// characters long and lexicographically sortable. The ULIDs start with the
+// milliseconds since Unix epoch returned by now, or by system time when now is
+// nil.
+func NewULIDGenerator(now func() time.Time) TokenGenerator {
+	if now == nil {
+		now = time.Now
+	}
+	return &ulidGenerator{now: now}
+}
+
+// NewToken generates a new ULID.
+func (self *ulidGenerator) NewToken() (string, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[6:]); err != nil {
+		return "", err
+	}
+
+	ms := uint64(self.now().UnixMilli())
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+
+	// Encodes 128 bits as 26 characters of 5 bits, the first character holds
+	// only 3 bits.
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	var buf [26]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = ULID_ALPHABET[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:]), nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crypt
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+func testTokenGenerator(
+	t *testing.T,
+	g TokenGenerator,
+	format *regexp.Regexp,
+) []string {
+	tokens := make([]string, 0, 100)
+	dict := make(map[string]bool)
+	for i := 0; i < cap(tokens); i++ {
+		token, err := g.NewToken()
+		if err != nil {
+			t.Fatalf("The token could not be generated: %v", err)
+		}
+		if !format.MatchString(token) {
+			t.Fatalf("The token %s does not match %s", token, format)
+		}
+		if dict[token] {
+			t.Fatalf("The token %s was generated twice", token)
+		}
+		dict[token] = true
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func TestUUIDGenerator(t *testing.T) {
+	testTokenGenerator(t, NewUUIDv4Generator(), regexp.MustCompile(
+		`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+
+	now := time.Unix(1700000000, 0)
+	tokens := testTokenGenerator(t,
+		NewUUIDv7Generator(func() time.Time { return now }),
+		regexp.MustCompile(
+			`^018bcfe5-6800-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+	if len(tokens) == 0 {
+		t.Error("No UUID was generated")
+	}
+}
+
+func TestULIDGenerator(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tokens := testTokenGenerator(t,
+		NewULIDGenerator(func() time.Time {
+			now = now.Add(time.Millisecond)
+			return now
+		}),
+		regexp.MustCompile(`^01HF7YAT[0-9A-HJKMNP-TV-Z]{18}$`))
+
+	if !sort.StringsAreSorted(tokens) {
+		t.Error("The ULIDs should be sorted by generation time")
+	}
+}
+
+func TestSignedTokenGenerator(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := NewSignedTokenGenerator([]byte("secret"), func() time.Time {
+		return now
+	})
+	tokens := testTokenGenerator(t, g,
+		regexp.MustCompile(`^v1\.[\w-]{32}\.[\w-]{43}$`))
+
+	if issued, err := g.Verify(tokens[0]); err != nil || !issued.Equal(now) {
+		t.Errorf("The token should be issued at %v, got %v (%v)",
+			now, issued, err)
+	}
+
+	forged := tokens[0][:len(tokens[0])-1] + "A"
+	if forged == tokens[0] {
+		forged = tokens[0][:len(tokens[0])-1] + "B"
+	}
+	if _, err := g.Verify(forged); err == nil {
+		t.Error("The forged token should not be verified")
+	}
+	other := NewSignedTokenGenerator([]byte("other"), nil)
+	if _, err := other.Verify(tokens[0]); err == nil {
+		t.Error("The token should not be verified by other key")
+	}
+	if _, err := g.Verify("v1.abc"); err == nil {
+		t.Error("The malformed token should not be verified")
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"math"
+)
+
+// CompareAndSwap sets the value of specified key to new when its current value
+// is equal to old. Returns whether the value was swapped. The expiration time
+// of the value is postponed even when it is not swapped.
+//
+// The values are compared by == operator, then it panics when the current
+// value is not comparable.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TypedCache[K, V]) CompareAndSwap(key K, old, new V) (bool, error) {
+	return s.modify(key, func(value V) (V, bool, error) {
+		if interface{}(value) != interface{}(old) {
+			return value, false, nil
+		}
+		return new, true, nil
+	})
+}
+
+// Decrement subtracts delta from the value of specified key, which must be a
+// signed integer, and returns the new value. The expiration time of the value
+// is postponed.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+// NotIntegerError when the value is not a signed integer.
+// OverflowError when the new value does not fit into the value type.
+func (s *TypedCache[K, V]) Decrement(key K, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, OverflowError(keyString(key))
+	}
+	return s.Increment(key, -delta)
+}
+
+// Increment adds delta to the value of specified key, which must be a signed
+// integer, and returns the new value. The expiration time of the value is
+// postponed.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+// NotIntegerError when the value is not a signed integer.
+// OverflowError when the new value does not fit into the value type.
+func (s *TypedCache[K, V]) Increment(key K, delta int64) (int64, error) {
+	var result int64
+	_, err := s.modify(key, func(value V) (V, bool, error) {
+		n, sum, err := addInt(keyString(key), interface{}(value), delta)
+		if err != nil {
+			return value, false, err
+		}
+
+		result = sum
+		return n.(V), true, nil
+	})
+	return result, err
+}
+
+// Update sets the value of specified key to the value returned by f, which
+// receives the current value. The value is not changed when f returns an
+// error. The expiration time of the value is postponed.
+//
+// The function f is called with the lock of current instance held, then it
+// must not call current instance.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found; or the error returned
+// by f.
+func (s *TypedCache[K, V]) Update(key K, f func(old V) (V, error)) error {
+	_, err := s.modify(key, func(value V) (V, bool, error) {
+		v, err := f(value)
+		return v, err == nil, err
+	})
+	return err
+}
+
+// modify sets the value of specified key to the value returned by f, when f
+// reports it as changed, and broadcasts the change. Returns whether the value
+// was changed.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found; or the error returned
+// by f.
+func (s *TypedCache[K, V]) modify(
+	key K,
+	f func(value V) (V, bool, error),
+) (bool, error) {
+	changed, err := s.change(key, f)
+	if changed {
+		s.bus.Publish(InvalidateKey, key)
+	}
+	return changed, err
+}
+
+// change sets the value of specified key to the value returned by f, when f
+// reports it as changed, without broadcasting.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found; or the error returned
+// by f.
+func (s *TypedCache[K, V]) change(
+	key K,
+	f func(value V) (V, bool, error),
+) (bool, error) {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
+
+	v, err := s.unsafeGet(key)
+	if err != nil {
+		return false, err
+	}
+
+	s.postpone(v)
+	s.accessed(v)
+	value, changed, err := f(v.value)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	v.value = value
+	s.resize(v)
+	s.evict(0, 0)
+	return true, nil
+}
+
+// addInt adds delta to specified signed integer value of specified key.
+// Returns the new value, keeping the type of value, and its int64
+// representation.
+//
+// Errors:
+// NotIntegerError when the value is not a signed integer.
+// OverflowError when the new value does not fit into the value type.
+func addInt(
+	key string,
+	value interface{},
+	delta int64,
+) (interface{}, int64, error) {
+	var a, min, max int64
+	switch v := value.(type) {
+	case int:
+		a, min, max = int64(v), math.MinInt, math.MaxInt
+	case int8:
+		a, min, max = int64(v), math.MinInt8, math.MaxInt8
+	case int16:
+		a, min, max = int64(v), math.MinInt16, math.MaxInt16
+	case int32:
+		a, min, max = int64(v), math.MinInt32, math.MaxInt32
+	case int64:
+		a, min, max = v, math.MinInt64, math.MaxInt64
+	default:
+		return value, 0, NotIntegerError(key)
+	}
+
+	if (delta > 0 && a > max-delta) || (delta < 0 && a < min-delta) {
+		return value, 0, OverflowError(key)
+	}
+	n := a + delta
+
+	switch value.(type) {
+	case int:
+		return int(n), n, nil
+	case int8:
+		return int8(n), n, nil
+	case int16:
+		return int16(n), n, nil
+	case int32:
+		return int32(n), n, nil
+	default:
+		return n, n, nil
+	}
+}
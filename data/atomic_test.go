@@ -0,0 +1,112 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/skarllot/raiqub"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	ts := NewCache(time.Minute)
+	ts.Add("v1", "a")
+
+	if ok, err := ts.CompareAndSwap("v1", "b", "c"); ok || err != nil {
+		t.Error("The value v1 should not be swapped from unexpected value")
+	}
+	if ok, err := ts.CompareAndSwap("v1", "a", "c"); !ok || err != nil {
+		t.Error("The value v1 should be swapped from expected value")
+	}
+	if v, _ := ts.Get("v1"); v != "c" {
+		t.Errorf("The value v1 should be c, got %v", v)
+	}
+	if _, err := ts.CompareAndSwap("v2", nil, "c"); err == nil {
+		t.Error("Should not be possible to swap an invalid value")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ts := NewTypedCache[string, []string](time.Minute)
+	ts.Add("v1", []string{"a"})
+
+	err := ts.Update("v1", func(old []string) ([]string, error) {
+		return append(old, "b"), nil
+	})
+	if err != nil {
+		t.Errorf("The value v1 could not be updated: %v", err)
+	}
+
+	failure := errors.New("failure")
+	err = ts.Update("v1", func(old []string) ([]string, error) {
+		return nil, failure
+	})
+	if err != failure {
+		t.Errorf("The update error should be returned, got %v", err)
+	}
+	if v, _ := ts.Get("v1"); len(v) != 2 || v[1] != "b" {
+		t.Errorf("The value v1 should be [a b], got %v", v)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	ts := NewCache(time.Minute)
+	ts.Add("v1", int8(math.MaxInt8-1))
+	ts.Add("v2", int64(math.MinInt64))
+	ts.Add("v3", "a")
+
+	if n, err := ts.Increment("v1", 1); err != nil || n != math.MaxInt8 {
+		t.Errorf("The value v1 should be incremented, got %d (%v)", n, err)
+	}
+	if v, _ := ts.Get("v1"); v != int8(math.MaxInt8) {
+		t.Errorf("The value v1 should keep its type, got %#v", v)
+	}
+	if _, err := ts.Increment("v1", 1); err != OverflowError("v1") {
+		t.Errorf("The value v1 should overflow, got %v", err)
+	}
+	if _, err := ts.Decrement("v2", 1); err != OverflowError("v2") {
+		t.Errorf("The value v2 should overflow, got %v", err)
+	}
+	if n, err := ts.Decrement("v2", math.MinInt64); err == nil {
+		t.Errorf("The value v2 should overflow, got %d", n)
+	}
+	if _, err := ts.Increment("v3", 1); err != NotIntegerError("v3") {
+		t.Errorf("The value v3 should not be incremented, got %v", err)
+	}
+	if _, err := ts.Increment("v4", 1); err != raiqub.InvalidKeyError("v4") {
+		t.Errorf("The value v4 should not be found, got %v", err)
+	}
+}
+
+func TestIncrementPostpone(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	ts := NewShardedCache(2, time.Millisecond*10, WithClock(clock))
+	ts.Add("v1", 0)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Millisecond * 5)
+		ts.Increment("v1", 2)
+	}
+	clock.Advance(time.Millisecond * 5)
+
+	if v, err := ts.Get("v1"); err != nil || v != 6 {
+		t.Errorf("The value v1 should be postponed and equal to 6, got %v", v)
+	}
+}
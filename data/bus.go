@@ -0,0 +1,154 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// An InvalidationOp represents the operation requested by an invalidation
+// message.
+type InvalidationOp int
+
+const (
+	// Requests to remove a single key.
+	InvalidateKey InvalidationOp = iota
+	// Requests to remove every key.
+	InvalidateAll
+)
+
+// An InvalidationMessage represents a request to invalidate cached values on
+// peer caches.
+type InvalidationMessage struct {
+	// Unique identifier of the cache that published current message.
+	Origin string
+	// Requested operation.
+	Op InvalidationOp
+	// Key to invalidate; not used by InvalidateAll.
+	Key interface{}
+}
+
+// An InvalidationBus defines a transport that broadcasts invalidation messages
+// between caches.
+type InvalidationBus interface {
+	// Publish broadcasts specified message to every subscriber.
+	Publish(msg InvalidationMessage) error
+	// Subscribe registers a function that is called for every received
+	// message. Returns a function that cancels the subscription.
+	Subscribe(f func(msg InvalidationMessage)) (cancel func())
+}
+
+// A LocalBus provides an in-process InvalidationBus, where messages are
+// delivered synchronously to every subscriber.
+type LocalBus struct {
+	subscribers map[int]func(InvalidationMessage)
+	next        int
+	sync.RWMutex
+}
+
+// NewLocalBus creates a new instance of LocalBus.
+func NewLocalBus() *LocalBus {
+	return &LocalBus{
+		subscribers: make(map[int]func(InvalidationMessage)),
+	}
+}
+
+// Publish delivers specified message to every subscriber.
+func (s *LocalBus) Publish(msg InvalidationMessage) error {
+	s.RLock()
+	list := make([]func(InvalidationMessage), 0, len(s.subscribers))
+	for _, f := range s.subscribers {
+		list = append(list, f)
+	}
+	s.RUnlock()
+
+	for _, f := range list {
+		f(msg)
+	}
+	return nil
+}
+
+// Subscribe registers a function that is called for every published message.
+func (s *LocalBus) Subscribe(f func(msg InvalidationMessage)) func() {
+	s.Lock()
+	defer s.Unlock()
+
+	id := s.next
+	s.next++
+	s.subscribers[id] = f
+	return func() {
+		s.Lock()
+		defer s.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// A busLink represents the subscription of a cache to an InvalidationBus.
+type busLink struct {
+	bus    InvalidationBus
+	origin string
+	cancel func()
+}
+
+// newBusLink subscribes to specified bus, calling handler for every message
+// published by other caches.
+func newBusLink(
+	bus InvalidationBus,
+	handler func(InvalidationMessage),
+) *busLink {
+	l := &busLink{
+		bus:    bus,
+		origin: newOrigin(),
+	}
+	l.cancel = bus.Subscribe(func(msg InvalidationMessage) {
+		if msg.Origin != l.origin {
+			handler(msg)
+		}
+	})
+	return l
+}
+
+// Publish broadcasts a message for specified operation and key. Failures are
+// ignored since local cache was already changed.
+func (l *busLink) Publish(op InvalidationOp, key interface{}) {
+	if l == nil {
+		return
+	}
+	l.bus.Publish(InvalidationMessage{
+		Origin: l.origin,
+		Op:     op,
+		Key:    key,
+	})
+}
+
+// Close cancels the subscription.
+func (l *busLink) Close() {
+	if l != nil {
+		l.cancel()
+	}
+}
+
+// newOrigin creates a random unique identifier to a cache.
+func newOrigin() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("Could not access secure random generator")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skarllot/raiqub"
+)
+
+// testInvalidation tests the invalidation between the specified caches which
+// are connected to a bus. The wait function waits until the condition is true.
+func testInvalidation(
+	t *testing.T,
+	caches []*Cache,
+	wait func(func() bool) bool,
+) {
+	for _, c := range caches {
+		c.Add("v1", 1)
+		c.Add("v2", 2)
+		c.Add("v3", 3)
+	}
+
+	caches[0].Delete("v1")
+	caches[1].Set("v2", 20)
+
+	if !wait(func() bool {
+		for _, c := range caches[1:] {
+			if _, err := c.Get("v1"); err == nil {
+				return false
+			}
+		}
+		for i, c := range caches {
+			_, err := c.Get("v2")
+			if (i == 1) != (err == nil) {
+				return false
+			}
+		}
+		return true
+	}) {
+		t.Error("The deleted and changed values were not invalidated on peers")
+	}
+	if v, err := caches[1].Get("v2"); err != nil || v != 20 {
+		t.Error("The changed value should be kept by its origin")
+	}
+
+	caches[2].Flush()
+	if !wait(func() bool {
+		for _, c := range caches {
+			if c.Count() != 0 {
+				return false
+			}
+		}
+		return true
+	}) {
+		t.Error("The flush was not broadcast to peers")
+	}
+}
+
+func TestLocalBusInvalidation(t *testing.T) {
+	bus := NewLocalBus()
+	caches := make([]*Cache, 3)
+	for i := range caches {
+		caches[i] = NewCache(time.Minute, WithInvalidationBus(bus))
+		defer caches[i].Close()
+	}
+
+	testInvalidation(t, caches, func(f func() bool) bool {
+		return f()
+	})
+}
+
+func TestTCPBusInvalidation(t *testing.T) {
+	buses := make([]*TCPBus, 3)
+	for i := range buses {
+		bus, err := NewTCPBus("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("The TCP bus could not listen: %v", err)
+		}
+		defer bus.Close()
+		buses[i] = bus
+	}
+	for _, b := range buses {
+		for _, peer := range buses {
+			if peer != b {
+				b.AddPeer(peer.Addr().String())
+			}
+		}
+	}
+
+	caches := make([]*Cache, 3)
+	for i := range caches {
+		caches[i] = NewCache(time.Minute, WithInvalidationBus(buses[i]))
+		defer caches[i].Close()
+	}
+
+	testInvalidation(t, caches, func(f func() bool) bool {
+		return raiqub.WaitFunc(time.Millisecond, time.Second*5, f)
+	})
+}
+
+func TestTCPBusSlowPeer(t *testing.T) {
+	// The peer accepts connections but never reads from them
+	peer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("The peer could not listen: %v", err)
+	}
+	defer peer.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			c, err := peer.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, c)
+		}
+	}()
+
+	bus, err := NewTCPBus("127.0.0.1:0", peer.Addr().String())
+	if err != nil {
+		t.Fatalf("The TCP bus could not listen: %v", err)
+	}
+	delivered := 0
+	bus.Subscribe(func(InvalidationMessage) { delivered++ })
+
+	key := strings.Repeat("k", 64*1024)
+	start := time.Now()
+	var pubErr error
+	for i := 0; i < TCPBUS_QUEUE_SIZE*2; i++ {
+		err := bus.Publish(InvalidationMessage{Op: InvalidateKey, Key: key})
+		if err != nil {
+			pubErr = err
+		}
+	}
+	if elapsed := time.Since(start); elapsed > TCPBUS_WRITE_TIMEOUT {
+		t.Errorf("The publishing should not wait for peer: %v", elapsed)
+	}
+	if _, ok := pubErr.(PeerQueueFullError); !ok {
+		t.Errorf("The messages exceeding the queue should be dropped: %v",
+			pubErr)
+	}
+	if delivered != TCPBUS_QUEUE_SIZE*2 {
+		t.Errorf("Every message should be delivered locally: %d", delivered)
+	}
+
+	start = time.Now()
+	bus.Close()
+	if elapsed := time.Since(start); elapsed > TCPBUS_WRITE_TIMEOUT*2 {
+		t.Errorf("The bus should be closed without waiting for peer: %v",
+			elapsed)
+	}
+}
+
+func TestShardedCacheInvalidation(t *testing.T) {
+	bus := NewLocalBus()
+	c1 := NewShardedCache(4, time.Minute, WithInvalidationBus(bus))
+	c2 := NewShardedCache(4, time.Minute, WithInvalidationBus(bus))
+
+	c1.Add("v1", 1)
+	c2.Add("v1", 1)
+	c1.Set("v1", 10)
+	if _, err := c2.Get("v1"); err == nil {
+		t.Error("The changed value v1 was not invalidated on peer")
+	}
+	if v, _ := c1.Get("v1"); v != 10 {
+		t.Error("The changed value v1 should be kept by its origin")
+	}
+}
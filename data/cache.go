@@ -17,112 +17,336 @@
 package data
 
 import (
-	"github.com/skarllot/raiqub"
+	"container/heap"
+	"fmt"
 	"sync"
 	"time"
+
+	"github.com/skarllot/raiqub"
 )
 
 // A Cache provides in-memory key:value cache that expires after defined
-// duration of time.
-type Cache struct {
-	values   map[string]*cacheItem
-	lifetime time.Duration
-	sync.RWMutex
-}
+// duration of time. It is a TypedCache that stores any value by string keys.
+type Cache = TypedCache[string, interface{}]
 
 // NewCache creates a new instance of Cache and defines the default lifetime for
 // new cached items.
-func NewCache(d time.Duration) *Cache {
-	return &Cache{
-		values:   make(map[string]*cacheItem),
+func NewCache(d time.Duration, opts ...CacheOption) *Cache {
+	return NewTypedCache[string, interface{}](d, opts...)
+}
+
+// A TypedCache provides in-memory key:value cache that expires after defined
+// duration of time, where the types of keys and values are defined by K and V
+// respectively.
+//
+// Expired values are tracked by a min-heap ordered by expiration time, then
+// each operation only needs to inspect the values that are already expired.
+// Optionally a background janitor can be started to reclaim memory even when
+// current instance is not used (see WithJanitor), and the number and total size
+// of stored values can be limited (see WithCapacity and WithMaxBytes).
+//
+// Functions registered by OnEvicted are notified about every removed value.
+type TypedCache[K comparable, V any] struct {
+	values       map[K]*cacheItem[K, V]
+	expiry       expirationHeap[K, V]
+	lifetime     time.Duration
+	janitor      *janitor
+	snapshots    *janitor
+	snapshotPath string
+	snapshotErr  snapshotError
+	maxEntries   int
+	maxBytes     int64
+	sizer        Sizer
+	newPolicy    func() EvictionPolicy
+	policy       EvictionPolicy
+	evictionHook func(key K, value V)
+	onEvicted    []EvictedFunc[K, V]
+	evicted      []eviction[K, V]
+	loader       func(key K) (V, error)
+	loading      map[K]*loadCall[V]
+	counters     cacheCounters
+	tags         map[string]map[K]struct{}
+	bus          *busLink
+	clock        Clock
+	sync.RWMutex
+}
+
+// NewTypedCache creates a new instance of TypedCache and defines the default
+// lifetime for new cached items.
+func NewTypedCache[K comparable, V any](
+	d time.Duration,
+	opts ...CacheOption,
+) *TypedCache[K, V] {
+	o := newCacheOptions(opts)
+	c := &TypedCache[K, V]{
+		values:   make(map[K]*cacheItem[K, V]),
 		lifetime: d,
+		loading:  make(map[K]*loadCall[V]),
+		tags:     make(map[string]map[K]struct{}),
+		clock:    o.clock,
+		sizer:    o.sizer,
 	}
+
+	if o.maxEntries > 0 || o.maxBytes > 0 {
+		c.maxEntries = o.maxEntries
+		c.maxBytes = o.maxBytes
+		c.newPolicy = o.newPolicy
+		if c.newPolicy == nil {
+			c.newPolicy = NewLRUPolicy
+		}
+		c.policy = c.newPolicy()
+	}
+
+	if o.janitorInterval > 0 {
+		c.janitor = startJanitor(c.clock, o.janitorInterval, c.sweep)
+	}
+
+	if o.snapshotPath != "" && o.snapshotEvery > 0 {
+		c.snapshotPath = o.snapshotPath
+		c.snapshots = startJanitor(c.clock, o.snapshotEvery, func() {
+			c.snapshotErr.Set(c.SaveFile(c.snapshotPath))
+		})
+	}
+
+	if o.bus != nil {
+		c.bus = newBusLink(o.bus, c.receive)
+	}
+
+	return c
 }
 
-// Add adds a new key:value to current Cache instance.
+// Add adds a new key:value to current TypedCache instance. When current
+// instance is full, the value selected by its EvictionPolicy is evicted.
 //
 // Errors:
 // DuplicatedKeyError when requested key already exists.
-func (s *Cache) Add(key string, value interface{}) error {
-	lckStatus := s.removeExpired()
+func (s *TypedCache[K, V]) Add(key K, value V) error {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
 
-	i := &cacheItem{
-		expireAt: time.Now().Add(s.lifetime),
-		lifetime: s.lifetime,
-		value:    value,
+	if _, ok := s.values[key]; ok {
+		return raiqub.DuplicatedKeyError(keyString(key))
 	}
 
-	if lckStatus == raiqub.ReadLocked {
-		s.RUnlock()
-		s.Lock()
-	}
-	defer s.Unlock()
+	s.insert(key, value, ItemOptions{Lifetime: s.lifetime})
+	return nil
+}
+
+// AddWithOptions adds a new key:value to current TypedCache instance using
+// specified settings. When opts defines neither a lifetime nor a deadline the
+// default lifetime is used.
+//
+// Errors:
+// DuplicatedKeyError when requested key already exists.
+func (s *TypedCache[K, V]) AddWithOptions(
+	key K,
+	value V,
+	opts ItemOptions,
+) error {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
 
 	if _, ok := s.values[key]; ok {
-		return raiqub.DuplicatedKeyError(key)
+		return raiqub.DuplicatedKeyError(keyString(key))
 	}
 
-	s.values[key] = i
+	if opts.Lifetime == 0 && opts.Deadline.IsZero() {
+		opts.Lifetime = s.lifetime
+	}
+	s.insert(key, value, opts)
 	return nil
 }
 
-// Count gets the number of cached values by current instance.
-func (s *Cache) Count() int {
-	if s.removeExpired() == raiqub.WriteLocked {
-		defer s.Unlock()
-	} else {
-		defer s.RUnlock()
+// Clock returns the Clock used to expire the values of current instance, e.g.
+// to define their deadlines (see AddWithOptions).
+func (s *TypedCache[K, V]) Clock() Clock {
+	return s.clock
+}
+
+// Close stops the background janitor, if any. When periodic snapshots are
+// enabled, they are stopped and a last snapshot is written. Returns the error
+// of the last snapshot or, when it succeeds, of the last failed periodic
+// snapshot. It is safe to call Close more than once.
+func (s *TypedCache[K, V]) Close() error {
+	if s.janitor != nil {
+		s.janitor.Stop()
+	}
+	s.bus.Close()
+	if s.snapshots != nil {
+		s.snapshots.Stop()
+		if err := s.SaveFile(s.snapshotPath); err != nil {
+			return err
+		}
+		return s.snapshotErr.Err()
 	}
+	return nil
+}
+
+// Count gets the number of cached values by current instance.
+func (s *TypedCache[K, V]) Count() int {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
 
 	return len(s.values)
 }
 
 // Flush deletes any cached value into current instance.
-func (s *Cache) Flush() {
+func (s *TypedCache[K, V]) Flush() {
+	s.flush()
+	s.bus.Publish(InvalidateAll, nil)
+}
+
+// flush deletes any cached value into current instance without broadcasting.
+func (s *TypedCache[K, V]) flush() {
 	s.Lock()
-	defer s.Unlock()
+	defer s.unlock()
 
-	s.values = make(map[string]*cacheItem)
+	if s.notifying() {
+		for _, i := range s.values {
+			s.evicted = append(s.evicted,
+				eviction[K, V]{i.key, i.value, EvictFlushed})
+		}
+	}
+	s.counters.evictions[EvictFlushed].Add(uint64(len(s.values)))
+	s.counters.size.Store(0)
+	s.counters.bytes.Store(0)
+	s.values = make(map[K]*cacheItem[K, V])
+	s.expiry = nil
+	s.tags = make(map[string]map[K]struct{})
+	if s.policy != nil {
+		s.policy = s.newPolicy()
+	}
 }
 
-// Get gets the value cached by specified key.
+// Get gets the value cached by specified key. When the key could not be found
+// and a loader is defined by SetLoader, the value is loaded and stored.
 //
 // Errors:
-// InvalidKeyError when requested key could not be found.
-func (s *Cache) Get(key string) (interface{}, error) {
-	if s.removeExpired() == raiqub.WriteLocked {
-		s.Unlock()
-		s.RLock()
-	}
-	defer s.RUnlock()
+// InvalidKeyError when requested key could not be found and no loader is
+// defined; or the error returned by loader.
+func (s *TypedCache[K, V]) Get(key K) (V, error) {
+	s.Lock()
+	s.removeExpired()
 
 	v, err := s.unsafeGet(key)
 	if err != nil {
-		return nil, err
+		s.counters.misses.Add(1)
+		loader := s.loader
+		s.unlock()
+		if loader == nil {
+			var zero V
+			return zero, err
+		}
+		return s.getOrAdd(key, func() (V, error) {
+			return loader(key)
+		}, false)
 	}
-	v.Postpone()
-	return v.value, nil
+	s.counters.hits.Add(1)
+	s.postpone(v)
+	s.accessed(v)
+	value := v.value
+	s.unlock()
+	return value, nil
+}
+
+// GetOrAdd gets the value cached by specified key or, when it could not be
+// found, adds the value returned by f.
+//
+// Concurrent calls for the same missing key wait for a single call of f and
+// then share its result. The value is not stored when f returns an error.
+//
+// Errors:
+// The error returned by f.
+func (s *TypedCache[K, V]) GetOrAdd(key K, f func() (V, error)) (V, error) {
+	return s.getOrAdd(key, f, true)
+}
+
+// getOrAdd implements GetOrAdd, where count defines whether the lookup should
+// be counted as a hit or a miss.
+func (s *TypedCache[K, V]) getOrAdd(
+	key K,
+	f func() (V, error),
+	count bool,
+) (value V, err error) {
+	s.Lock()
+	s.removeExpired()
+
+	if v, ok := s.values[key]; ok {
+		if count {
+			s.counters.hits.Add(1)
+		}
+		s.postpone(v)
+		s.accessed(v)
+		value = v.value
+		s.unlock()
+		return value, nil
+	}
+
+	if count {
+		s.counters.misses.Add(1)
+	}
+	if c, ok := s.loading[key]; ok {
+		s.unlock()
+		c.wg.Wait()
+		return c.value, c.err
+	}
+
+	c := &loadCall[V]{err: LoaderPanicError(keyString(key))}
+	c.wg.Add(1)
+	s.loading[key] = c
+	s.unlock()
+
+	defer func() {
+		s.Lock()
+		delete(s.loading, key)
+		if c.err == nil {
+			if v, ok := s.values[key]; ok {
+				c.value = v.value
+			} else {
+				s.insert(key, c.value, ItemOptions{Lifetime: s.lifetime})
+			}
+		}
+		s.unlock()
+		c.wg.Done()
+		// Returns the stored value, which could be added concurrently
+		value, err = c.value, c.err
+	}()
+
+	c.value, c.err = f()
+	return
 }
 
 // Delete deletes the specified key:value.
 //
 // Errors:
 // InvalidKeyError when requested key could not be found.
-func (s *Cache) Delete(key string) error {
-	lckStatus := s.removeExpired()
-
-	_, err := s.unsafeGet(key)
-	if err != nil {
+func (s *TypedCache[K, V]) Delete(key K) error {
+	if err := s.delete(key); err != nil {
 		return err
 	}
 
-	if lckStatus == raiqub.ReadLocked {
-		s.RUnlock()
-		s.Lock()
+	s.bus.Publish(InvalidateKey, key)
+	return nil
+}
+
+// delete deletes the specified key:value without broadcasting.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TypedCache[K, V]) delete(key K) error {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
+
+	v, err := s.unsafeGet(key)
+	if err != nil {
+		return err
 	}
-	defer s.Unlock()
 
-	delete(s.values, key)
+	s.remove(v, EvictDeleted)
 	return nil
 }
 
@@ -130,33 +354,91 @@ func (s *Cache) Delete(key string) error {
 //
 // Errors:
 // InvalidKeyError when requested key could not be found.
-func (s *Cache) Set(key string, value interface{}) error {
-	if s.removeExpired() == raiqub.WriteLocked {
-		s.Unlock()
-		s.RLock()
+func (s *TypedCache[K, V]) Set(key K, value V) error {
+	if err := s.set(key, value); err != nil {
+		return err
 	}
-	defer s.RUnlock()
+
+	s.bus.Publish(InvalidateKey, key)
+	return nil
+}
+
+// set sets the value of specified key without broadcasting.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TypedCache[K, V]) set(key K, value V) error {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
 
 	v, err := s.unsafeGet(key)
 	if err != nil {
 		return err
 	}
 
-	v.Postpone()
+	s.postpone(v)
+	s.accessed(v)
 	v.value = value
+	s.resize(v)
+	s.evict(0, 0)
 	return nil
 }
 
+// InvalidateTag deletes every value carrying specified tag. Returns the number
+// of deleted values, which are notified as EvictDeleted.
+func (s *TypedCache[K, V]) InvalidateTag(tag string) int {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
+
+	keys := s.tags[tag]
+	count := len(keys)
+	for k := range keys {
+		s.remove(s.values[k], EvictDeleted)
+	}
+	return count
+}
+
+// OnEvicted registers a function that is called every time a value is removed
+// from current instance, either because it is expired, deleted, flushed or
+// evicted to free room. The function is called without holding any lock of
+// current instance, then it can safely call its methods.
+func (s *TypedCache[K, V]) OnEvicted(f EvictedFunc[K, V]) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.onEvicted = append(s.onEvicted, f)
+}
+
+// SetEvictionHook defines a function that is called every time a value is
+// evicted because current instance is full. The hook is called without holding
+// any lock of current instance.
+func (s *TypedCache[K, V]) SetEvictionHook(f func(key K, value V)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.evictionHook = f
+}
+
+// SetLoader defines a function that loads the values requested by Get that
+// could not be found. Concurrent requests for the same missing key wait for a
+// single load (see GetOrAdd).
+func (s *TypedCache[K, V]) SetLoader(f func(key K) (V, error)) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.loader = f
+}
+
 // SetLifetime modifies the lifetime of specified key:value.
 //
 // Errors:
 // InvalidKeyError when requested key could not be found.
-func (s *Cache) SetLifetime(key string, d time.Duration) error {
-	if s.removeExpired() == raiqub.WriteLocked {
-		s.Unlock()
-		s.RLock()
-	}
-	defer s.RUnlock()
+func (s *TypedCache[K, V]) SetLifetime(key K, d time.Duration) error {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
 
 	v, err := s.unsafeGet(key)
 	if err != nil {
@@ -164,30 +446,231 @@ func (s *Cache) SetLifetime(key string, d time.Duration) error {
 	}
 
 	v.lifetime = d
-	v.Postpone()
+	s.postpone(v)
+	s.accessed(v)
+	return nil
+}
+
+// SetDeadline modifies the absolute deadline of specified key:value. A zero
+// deadline disables absolute expiration.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TypedCache[K, V]) SetDeadline(key K, t time.Time) error {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
+
+	v, err := s.unsafeGet(key)
+	if err != nil {
+		return err
+	}
+
+	v.deadline = t
+	s.postpone(v)
+	s.accessed(v)
 	return nil
 }
 
-// removeExpired remove all expired values from current Cache instance list.
-// Returns the locking status of current instance.
-func (s *Cache) removeExpired() raiqub.LockStatus {
-	writeLocked := false
-	s.RLock()
-	for i := range s.values {
-		if s.values[i].IsExpired() {
-			if !writeLocked {
-				s.RUnlock()
-				s.Lock()
-				writeLocked = true
+// Stats returns the usage statistics of current instance.
+func (s *TypedCache[K, V]) Stats() CacheStats {
+	return s.counters.Stats()
+}
+
+// TTL returns the remaining time until specified key:value expires. Unlike
+// Get, it does not postpone the expiration.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TypedCache[K, V]) TTL(key K) (time.Duration, error) {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
+
+	v, err := s.unsafeGet(key)
+	if err != nil {
+		return 0, err
+	}
+	return v.TTL(s.clock.Now()), nil
+}
+
+// accessed notifies the EvictionPolicy, if any, that specified item was used.
+// Must be called with write lock held.
+func (s *TypedCache[K, V]) accessed(i *cacheItem[K, V]) {
+	if s.policy != nil {
+		s.policy.Accessed(i.key)
+	}
+}
+
+// evict removes values selected by EvictionPolicy until there is room to
+// specified number of new entries totaling specified size. Must be called with
+// write lock held.
+func (s *TypedCache[K, V]) evict(entries int, size int64) {
+	if s.policy == nil {
+		return
+	}
+
+	for s.full(entries, size) {
+		key, ok := s.policy.Victim()
+		if !ok {
+			break
+		}
+		i, ok := s.values[key.(K)]
+		if !ok {
+			s.policy.Removed(key)
+			continue
+		}
+		s.remove(i, EvictCapacity)
+	}
+}
+
+// full returns whether current instance has no room to specified number of new
+// entries totaling specified size. Must be called with lock held.
+func (s *TypedCache[K, V]) full(entries int, size int64) bool {
+	if len(s.values) == 0 {
+		return false
+	}
+	if s.maxEntries > 0 && len(s.values)+entries > s.maxEntries {
+		return true
+	}
+	return s.maxBytes > 0 && s.counters.bytes.Load()+size > s.maxBytes
+}
+
+// insert stores a new item for specified key:value, evicting values when
+// current instance is full. Must be called with write lock held.
+//
+// A value larger than max bytes is stored after evicting every other value.
+func (s *TypedCache[K, V]) insert(key K, value V, opts ItemOptions) {
+	size := sizeOf(s.sizer, value)
+	s.evict(1, size)
+
+	i := &cacheItem[K, V]{
+		key:      key,
+		lifetime: opts.Lifetime,
+		deadline: opts.Deadline,
+		tags:     opts.Tags,
+		value:    value,
+		size:     size,
+	}
+	i.Postpone(s.clock.Now())
+	s.values[key] = i
+	for _, t := range i.tags {
+		keys, ok := s.tags[t]
+		if !ok {
+			keys = make(map[K]struct{})
+			s.tags[t] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	heap.Push(&s.expiry, i)
+	s.counters.adds.Add(1)
+	s.counters.size.Add(1)
+	s.counters.bytes.Add(size)
+	if s.policy != nil {
+		s.policy.Added(key)
+	}
+}
+
+// notifying returns whether removed values should be notified. Must be called
+// with lock held.
+func (s *TypedCache[K, V]) notifying() bool {
+	return s.evictionHook != nil || len(s.onEvicted) > 0
+}
+
+// postpone postpones the expiration of specified item and updates its position
+// into expiration heap. Must be called with write lock held.
+func (s *TypedCache[K, V]) postpone(i *cacheItem[K, V]) {
+	i.Postpone(s.clock.Now())
+	heap.Fix(&s.expiry, i.index)
+}
+
+// receive applies an invalidation message received from a peer cache.
+func (s *TypedCache[K, V]) receive(msg InvalidationMessage) {
+	switch msg.Op {
+	case InvalidateKey:
+		if key, ok := msg.Key.(K); ok {
+			s.delete(key)
+		}
+	case InvalidateAll:
+		s.flush()
+	}
+}
+
+// remove removes specified item from current TypedCache instance and enqueues
+// its notification. Must be called with write lock held.
+func (s *TypedCache[K, V]) remove(i *cacheItem[K, V], reason EvictReason) {
+	heap.Remove(&s.expiry, i.index)
+	delete(s.values, i.key)
+	for _, t := range i.tags {
+		if keys, ok := s.tags[t]; ok {
+			delete(keys, i.key)
+			if len(keys) == 0 {
+				delete(s.tags, t)
 			}
-			delete(s.values, i)
 		}
 	}
+	s.counters.evictions[reason].Add(1)
+	s.counters.size.Add(-1)
+	s.counters.bytes.Add(-i.size)
+	if s.policy != nil {
+		s.policy.Removed(i.key)
+	}
+	if s.notifying() {
+		s.evicted = append(s.evicted, eviction[K, V]{i.key, i.value, reason})
+	}
+}
 
-	if writeLocked {
-		return raiqub.WriteLocked
-	} else {
-		return raiqub.ReadLocked
+// removeExpired remove all expired values from current TypedCache instance.
+// Must be called with write lock held.
+//
+// Only the values that expire first are inspected, then it takes constant time
+// when there are no expired values.
+func (s *TypedCache[K, V]) removeExpired() {
+	now := s.clock.Now()
+	for {
+		i := s.expiry.Peek()
+		if i == nil || !i.IsExpired(now) {
+			return
+		}
+		if i.IsDeadline() {
+			s.remove(i, EvictDeadline)
+		} else {
+			s.remove(i, EvictExpired)
+		}
+	}
+}
+
+// resize updates the size of specified item from its current value. Must be
+// called with write lock held.
+func (s *TypedCache[K, V]) resize(i *cacheItem[K, V]) {
+	size := sizeOf(s.sizer, i.value)
+	s.counters.bytes.Add(size - i.size)
+	i.size = size
+}
+
+// sweep removes all expired values from current TypedCache instance.
+func (s *TypedCache[K, V]) sweep() {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
+}
+
+// unlock releases the write lock and then notifies the removed values to
+// registered functions.
+func (s *TypedCache[K, V]) unlock() {
+	evicted := s.evicted
+	s.evicted = nil
+	hook := s.evictionHook
+	onEvicted := s.onEvicted
+	s.Unlock()
+
+	for _, e := range evicted {
+		if hook != nil && e.reason == EvictCapacity {
+			hook(e.key, e.value)
+		}
+		for _, f := range onEvicted {
+			f(e.key, e.value, e.reason)
+		}
 	}
 }
 
@@ -195,10 +678,18 @@ func (s *Cache) removeExpired() raiqub.LockStatus {
 //
 // Errors:
 // InvalidKeyError when requested key could not be found.
-func (s *Cache) unsafeGet(key string) (*cacheItem, error) {
+func (s *TypedCache[K, V]) unsafeGet(key K) (*cacheItem[K, V], error) {
 	v, ok := s.values[key]
 	if !ok {
-		return nil, raiqub.InvalidKeyError(key)
+		return nil, raiqub.InvalidKeyError(keyString(key))
 	}
 	return v, nil
 }
+
+// keyString returns string representation of specified key.
+func keyString[K comparable](key K) string {
+	if str, ok := interface{}(key).(string); ok {
+		return str
+	}
+	return fmt.Sprint(key)
+}
@@ -19,134 +19,253 @@
 package data
 
 import (
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/skarllot/raiqub"
 )
 
+func newCacheStore(d time.Duration, clock Clock) Store {
+	return NewCache(d, WithClock(clock))
+}
+
 func TestValueExpiration(t *testing.T) {
-	ts := NewCache(time.Millisecond * 10)
+	testValueExpiration(t, newCacheStore)
+}
+
+func TestValueHandling(t *testing.T) {
+	testValueHandling(t, newCacheStore)
+}
+
+func TestValueIdCollision(t *testing.T) {
+	testValueIdCollision(t, newCacheStore)
+}
+
+func TestValueSetExpiration(t *testing.T) {
+	testValueSetExpiration(t, newCacheStore)
+}
+
+func TestJanitorExpiration(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	ts := NewCache(time.Millisecond*10,
+		WithJanitor(time.Millisecond*5), WithClock(clock))
+	defer ts.Close()
 
 	ts.Add("v1", nil)
 	ts.Add("v2", nil)
 
-	if _, err := ts.Get("v1"); err != nil {
-		t.Error("The value v1 was not stored")
+	clock.Advance(time.Millisecond * 10)
+
+	ts.RLock()
+	count := len(ts.values)
+	ts.RUnlock()
+	if count != 2 {
+		t.Errorf("The janitor should not remove live values, but %d remains",
+			count)
 	}
-	if _, err := ts.Get("v2"); err != nil {
-		t.Error("The value v2 was not stored")
+
+	clock.Advance(time.Millisecond * 5)
+
+	ts.RLock()
+	count = len(ts.values)
+	ts.RUnlock()
+	if count != 0 {
+		t.Errorf("The janitor should remove expired values, but %d remains",
+			count)
 	}
 
-	time.Sleep(time.Millisecond * 20)
+	if err := ts.Close(); err != nil {
+		t.Error("The janitor could not be stopped twice")
+	}
+}
+
+func TestValueDeadline(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	ts := NewCache(time.Second, WithClock(clock))
+
+	ts.AddWithOptions("v1", nil, ItemOptions{
+		Deadline: testEpoch.Add(time.Millisecond * 30),
+	})
+	ts.AddWithOptions("v2", nil, ItemOptions{
+		Lifetime: time.Millisecond * 20,
+		Deadline: testEpoch.Add(time.Second),
+	})
+	ts.AddWithOptions("v3", nil, ItemOptions{
+		Lifetime: time.Millisecond * 20,
+		Deadline: testEpoch.Add(time.Millisecond * 30),
+	})
+
+	for i := 0; i < 4; i++ {
+		clock.Advance(time.Millisecond * 10)
+		ts.Get("v1")
+		ts.Get("v2")
+		ts.Get("v3")
+	}
 
 	if _, err := ts.Get("v1"); err == nil {
-		t.Error("The value v1 was not expired")
+		t.Error("The value v1 should expire at its deadline")
 	}
-	if _, err := ts.Get("v2"); err == nil {
-		t.Error("The value v2 was not expired")
+	if _, err := ts.Get("v2"); err != nil {
+		t.Error("The value v2 should be postponed until its deadline")
+	}
+	if _, err := ts.Get("v3"); err == nil {
+		t.Error("The value v3 should expire at its deadline")
 	}
+}
+
+func TestValueTTL(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	ts := NewCache(time.Minute, WithClock(clock))
 
-	if err := ts.Delete("v1"); err == nil {
-		t.Error("The expired value v1 should not be removable")
+	ts.Add("v1", nil)
+	ts.AddWithOptions("v2", nil, ItemOptions{
+		Deadline: testEpoch.Add(time.Second),
+	})
+	clock.Advance(time.Millisecond * 500)
+
+	if ttl, err := ts.TTL("v1"); err != nil ||
+		ttl != time.Minute-time.Millisecond*500 {
+		t.Errorf("The value v1 should expire after default lifetime: %v", ttl)
+	}
+	if ttl, err := ts.TTL("v2"); err != nil ||
+		ttl != time.Millisecond*500 {
+		t.Errorf("The value v2 should expire at its deadline: %v", ttl)
 	}
-	if err := ts.Set("v2", nil); err == nil {
-		t.Error("The expired value v2 should not be changeable")
+	if _, err := ts.TTL("v3"); err == nil {
+		t.Error("The TTL of invalid value v3 should not be available")
 	}
 }
 
-func TestValueHandling(t *testing.T) {
-	testValues := map[string]int{
-		"v1":  3,
-		"v2":  6,
-		"v3":  83679,
-		"v4":  2748,
-		"v5":  54,
-		"v6":  6,
-		"v7":  2,
-		"v8":  8,
-		"v9":  7,
-		"v10": 8,
-	}
-	rmTestKey := "v5"
-	changeValues := map[string]int{
-		"v4": 5062,
-		"v9": 4099,
-	}
-
-	ts := NewCache(time.Millisecond * 10)
-
-	for k, v := range testValues {
-		err := ts.Add(k, v)
-		if err != nil {
-			t.Errorf("The value %s could not be added", k)
-		}
+func TestTypedCache(t *testing.T) {
+	type point struct {
+		x, y int
 	}
+	ts := NewTypedCache[int, point](time.Second)
 
-	if ts.Count() != len(testValues) {
-		t.Error("The values count do not match")
+	if err := ts.Add(1, point{1, 2}); err != nil {
+		t.Error("The value 1 could not be stored")
+	}
+	if err := ts.Add(1, point{3, 4}); err != raiqub.DuplicatedKeyError("1") {
+		t.Errorf("The duplicated value 1 should not be stored: %v", err)
 	}
 
-	for k, v := range testValues {
-		v2, err := ts.Get(k)
-		if err != nil {
-			t.Errorf("The value %s could not be read", k)
-		}
-		if v2 != v {
-			t.Errorf("The value %s was stored incorrectly", k)
-		}
+	if v, err := ts.Get(1); err != nil || v.x != 1 || v.y != 2 {
+		t.Error("The value 1 was stored incorrectly")
+	}
+	if _, err := ts.Get(2); err != raiqub.InvalidKeyError("2") {
+		t.Errorf("The value 2 should not be found: %v", err)
 	}
+}
+
+func TestCacheStats(t *testing.T) {
+	ts := NewCache(time.Minute, WithCapacity(2, nil))
+
+	ts.Add("v1", nil)
+	ts.Add("v2", nil)
+	ts.Add("v3", nil)
+	ts.Get("v3")
+	ts.Get("v1")
+	ts.Delete("v2")
+	ts.GetOrAdd("v4", func() (interface{}, error) {
+		return nil, nil
+	})
 
-	if err := ts.Delete(rmTestKey); err != nil {
-		t.Errorf("The value %s could not be removed", rmTestKey)
+	stats := ts.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("The cache should count 1 hit and 2 misses, got %d and %d",
+			stats.Hits, stats.Misses)
 	}
-	if _, err := ts.Get(rmTestKey); err == nil {
-		t.Errorf("The removed value %s should not be retrieved", rmTestKey)
+	if stats.Adds != 4 {
+		t.Errorf("The cache should count 4 additions, got %d", stats.Adds)
 	}
-	if ts.Count() == len(testValues) {
-		t.Error("The values count should not match")
+	if stats.Evictions[EvictCapacity] != 1 ||
+		stats.Evictions[EvictDeleted] != 1 {
+		t.Errorf("The cache evictions were not counted: %v", stats.Evictions)
 	}
-
-	for k, v := range changeValues {
-		err := ts.Set(k, v)
-		if err != nil {
-			t.Errorf("The value %s could not be changed", k)
-		}
+	if stats.Size != 2 {
+		t.Errorf("The cache size should be 2, got %d", stats.Size)
 	}
-	for k, v := range changeValues {
-		v2, err := ts.Get(k)
-		if err != nil {
-			t.Errorf("The value %s could not be read", k)
-		}
-		if v2 != v {
-			t.Errorf("The value %s was not changed", k)
-		}
+
+	ts.Flush()
+	stats = ts.Stats()
+	if stats.Size != 0 || stats.Evictions[EvictFlushed] != 2 {
+		t.Errorf("The flushed values were not counted: %v", stats)
 	}
 }
 
-func TestValueIdCollision(t *testing.T) {
-	ts := NewCache(time.Millisecond)
+func TestValueRange(t *testing.T) {
+	ts := NewCache(time.Minute)
 
-	if err := ts.Add("v1", nil); err != nil {
-		t.Error("The value v1 could not be stored")
+	ts.Add("user:1", 1)
+	ts.Add("user:2", 2)
+	ts.Add("group:1", 3)
+	ts.AddWithOptions("user:3", 4, ItemOptions{
+		Deadline: time.Now().Add(-time.Second),
+	})
+
+	values := make(map[string]interface{})
+	ts.Range(func(key string, value interface{}) bool {
+		// Must not deadlock
+		ts.Set(key, value)
+		values[key] = value
+		return true
+	})
+	if len(values) != 3 || values["user:2"] != 2 {
+		t.Errorf("The range should walk 3 live values, got %v", values)
 	}
-	if err := ts.Add("v1", nil); err == nil {
-		t.Error("The duplicated v1 could be stored")
+
+	count := 0
+	ts.Range(func(key string, value interface{}) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("The range should stop when requested, got %d calls", count)
 	}
-}
 
-func TestValueSetExpiration(t *testing.T) {
-	ts := NewCache(time.Millisecond)
+	keys := ts.Keys()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "group:1,user:1,user:2" {
+		t.Errorf("The keys were listed incorrectly: %v", keys)
+	}
 
-	ts.Add("v1", nil)
-	ts.SetLifetime("v1", time.Second)
+	keys = ts.KeysWithPrefix("user:")
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "user:1,user:2" {
+		t.Errorf("The keys with prefix were listed incorrectly: %v", keys)
+	}
+}
 
-	time.Sleep(time.Millisecond * 10)
+func TestValueTags(t *testing.T) {
+	ts := NewCache(time.Minute)
 
-	if _, err := ts.Get("v1"); err != nil {
-		t.Error("The value v1 is expired before expected")
-	}
+	ts.AddWithOptions("s1", nil, ItemOptions{Tags: []string{"user:1"}})
+	ts.AddWithOptions("s2", nil, ItemOptions{
+		Tags: []string{"user:1", "tenant:acme"},
+	})
+	ts.AddWithOptions("s3", nil, ItemOptions{
+		Tags: []string{"user:2", "tenant:acme"},
+	})
+	ts.Add("s4", nil)
 
-	if err := ts.SetLifetime("v2", time.Second); err == nil {
-		t.Error("Should not be possible to set duration for invalid value")
+	if count := ts.InvalidateTag("user:1"); count != 2 {
+		t.Errorf("The tag user:1 should invalidate 2 values, got %d", count)
+	}
+	if ts.Count() != 2 {
+		t.Errorf("The cache should hold 2 values, got %d", ts.Count())
+	}
+	if count := ts.InvalidateTag("tenant:acme"); count != 1 {
+		t.Errorf("The tag tenant:acme should invalidate 1 value, got %d",
+			count)
+	}
+	if _, err := ts.Get("s4"); err != nil {
+		t.Error("The untagged value s4 should not be invalidated")
+	}
+	if len(ts.tags) != 0 {
+		t.Errorf("The tag index should be empty, got %v", ts.tags)
 	}
 }
 
@@ -158,3 +277,31 @@ func BenchmarkValueCreation(b *testing.B) {
 		ts.Add(time.Now().Format(time.RFC3339Nano), time.Now())
 	}
 }
+
+func benchmarkParallel(b *testing.B, ts interface {
+	Add(string, interface{}) error
+	Get(string) (interface{}, error)
+}) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		ts.Add(keys[i], i)
+	}
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			ts.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func BenchmarkParallelCache(b *testing.B) {
+	benchmarkParallel(b, NewCache(time.Minute))
+}
+
+func BenchmarkParallelShardedCache(b *testing.B) {
+	benchmarkParallel(b, NewShardedCache(32, time.Minute))
+}
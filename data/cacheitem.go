@@ -20,20 +20,63 @@ import (
 	"time"
 )
 
+// An ItemOptions represents the settings of a cached value. When both Lifetime
+// and Deadline are defined the value expires at whichever comes first.
+type ItemOptions struct {
+	// The sliding lifetime of value, postponed every time it is used. Zero
+	// disables sliding expiration.
+	Lifetime time.Duration
+	// The absolute time when value expires, regardless of how it is used. Zero
+	// disables absolute expiration.
+	Deadline time.Time
+	// The tags attached to value, allowing to remove every value carrying a
+	// tag at once.
+	Tags []string
+}
+
 // A cacheItem represents a cached value that expires after defined time.
-type cacheItem struct {
+type cacheItem[K comparable, V any] struct {
+	key      K
 	expireAt time.Time
 	lifetime time.Duration
-	value    interface{}
+	deadline time.Time
+	tags     []string
+	value    V
+	size     int64
+	// Position of current item into expiration heap.
+	index int
+}
+
+// IsExpired returns whether current value is expired at specified time.
+func (i *cacheItem[K, V]) IsExpired(now time.Time) bool {
+	return now.After(i.expireAt)
 }
 
-// IsExpired returns whether current value is expired.
-func (i *cacheItem) IsExpired() bool {
-	return time.Now().After(i.expireAt)
+// IsDeadline returns whether current value expires at its deadline, instead of
+// by its lifetime.
+func (i *cacheItem[K, V]) IsDeadline() bool {
+	return !i.deadline.IsZero() && !i.expireAt.Before(i.deadline)
+}
+
+// Postpone value expiration time to specified current time added to its
+// lifetime duration. The expiration time is never postponed beyond its
+// deadline, and values that only have a deadline are not postponed.
+func (i *cacheItem[K, V]) Postpone(now time.Time) {
+	if i.deadline.IsZero() {
+		i.expireAt = now.Add(i.lifetime)
+		return
+	}
+
+	i.expireAt = i.deadline
+	if i.lifetime > 0 {
+		if t := now.Add(i.lifetime); t.Before(i.deadline) {
+			i.expireAt = t
+		}
+	}
 }
 
-// Postpone value expiration time to current time added to its lifetime
-// duration.
-func (i *cacheItem) Postpone() {
-	i.expireAt = time.Now().Add(i.lifetime)
+// TTL returns the remaining time, from specified current time, until current
+// value expires.
+func (i *cacheItem[K, V]) TTL(now time.Time) time.Duration {
+	return i.expireAt.Sub(now)
 }
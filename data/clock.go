@@ -0,0 +1,165 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Clock provides the current time and periodic calls, allowing to replace the
+// system clock on tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Tick calls f every d until the returned function is called.
+	Tick(d time.Duration, f func()) (stop func())
+}
+
+// NewSystemClock creates a Clock backed by system time.
+func NewSystemClock() Clock {
+	return systemClock{}
+}
+
+// A systemClock represents a Clock backed by system time.
+type systemClock struct{}
+
+// Now returns the current system time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Tick calls f every d from a new goroutine until the returned function is
+// called.
+func (systemClock) Tick(d time.Duration, f func()) func() {
+	ticker := time.NewTicker(d)
+	stop := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				f()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+	}
+}
+
+// A FakeClock provides a Clock which time only changes when requested. The
+// periodic calls are fired synchronously by Advance, then the expiration of
+// values can be tested deterministically.
+type FakeClock struct {
+	now     time.Time
+	tickers map[int]*fakeTicker
+	next    int
+	sync.Mutex
+}
+
+// A fakeTicker represents a periodic call registered to a FakeClock.
+type fakeTicker struct {
+	id       int
+	interval time.Duration
+	next     time.Time
+	f        func()
+}
+
+// NewFakeClock creates a new instance of FakeClock set to specified time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:     now,
+		tickers: make(map[int]*fakeTicker),
+	}
+}
+
+// Advance moves current time forward by d, firing every periodic call due
+// until the new time in chronological order.
+func (s *FakeClock) Advance(d time.Duration) {
+	s.Lock()
+	target := s.now.Add(d)
+	for {
+		t := s.nextTicker(target)
+		if t == nil {
+			break
+		}
+
+		s.now = t.next
+		t.next = t.next.Add(t.interval)
+		s.Unlock()
+		t.f()
+		s.Lock()
+	}
+	s.now = target
+	s.Unlock()
+}
+
+// Now returns the current time of current instance.
+func (s *FakeClock) Now() time.Time {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.now
+}
+
+// Tick registers f to be called every d when current time is advanced.
+func (s *FakeClock) Tick(d time.Duration, f func()) func() {
+	s.Lock()
+	defer s.Unlock()
+
+	id := s.next
+	s.next++
+	s.tickers[id] = &fakeTicker{
+		id:       id,
+		interval: d,
+		next:     s.now.Add(d),
+		f:        f,
+	}
+	return func() {
+		s.Lock()
+		defer s.Unlock()
+		delete(s.tickers, id)
+	}
+}
+
+// nextTicker returns the registered periodic call which is due first, but not
+// after limit. Must be called with lock held.
+func (s *FakeClock) nextTicker(limit time.Time) *fakeTicker {
+	list := make([]*fakeTicker, 0, len(s.tickers))
+	for _, t := range s.tickers {
+		if !t.next.After(limit) {
+			list = append(list, t)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].next.Equal(list[j].next) {
+			return list[i].id < list[j].id
+		}
+		return list[i].next.Before(list[j].next)
+	})
+	return list[0]
+}
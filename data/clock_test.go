@@ -0,0 +1,53 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+
+	var calls []string
+	stop1 := clock.Tick(time.Second*2, func() {
+		calls = append(calls, "a"+clock.Now().Sub(testEpoch).String())
+	})
+	clock.Tick(time.Second*3, func() {
+		calls = append(calls, "b"+clock.Now().Sub(testEpoch).String())
+	})
+
+	clock.Advance(time.Second * 6)
+	if now := clock.Now(); !now.Equal(testEpoch.Add(time.Second * 6)) {
+		t.Errorf("The clock should advance 6s, but it is at %v", now)
+	}
+
+	stop1()
+	clock.Advance(time.Second * 3)
+
+	expected := []string{"a2s", "b3s", "a4s", "a6s", "b6s", "b9s"}
+	if len(calls) != len(expected) {
+		t.Fatalf("The ticks should be %v, but got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("The ticks should be %v, but got %v", expected, calls)
+			break
+		}
+	}
+}
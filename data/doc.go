@@ -30,5 +30,91 @@ variables to selected functions.
 The lifetime of a value can be modified calling 'SetLifetime()'. The
 expiration time of a value is automatically updated when its value is retrieved
 by the following methods: 'Get()', 'Set()' and 'SetLifetime()'.
+
+A value added by 'AddWithOptions()' can also define an absolute deadline, then
+it expires at the deadline regardless of how it is used. The remaining time of
+a value is returned by 'TTL()'.
+
+Expired values are removed when the Cache is used. To reclaim memory of unused
+caches a background janitor can be started passing 'WithJanitor()' option to
+'NewCache()', then 'Close()' must be called to stop it.
+
+The number of values stored by a Cache can be limited passing 'WithCapacity()'
+option, then an EvictionPolicy (LRU, LFU or FIFO) selects which value is
+discarded when the Cache is full. Likewise, the 'WithMaxBytes()' option limits
+the total size of stored values, as measured by a Sizer function or by values
+implementing Sized interface.
+
+Functions registered by 'OnEvicted()' are notified every time a value is
+removed, along with the reason: expired, deleted, flushed, evicted by capacity
+or reached its deadline.
+
+The 'GetOrAdd()' method atomically gets a value or adds a computed one, and a
+loader defined by 'SetLoader()' makes 'Get()' to load missing values. In both
+cases concurrent requests for the same missing key trigger a single load.
+
+The cached values can be persisted calling 'SaveTo()' and restored calling
+'LoadFrom()', each value keeps its remaining lifetime. The 'WithSnapshot()'
+option periodically writes a snapshot to a file.
+
+The 'CompareAndSwap()', 'Update()', 'Increment()' and 'Decrement()' methods
+atomically change a value based on its current value, e.g. to implement
+optimistic updates and rate counters. Like 'Set()', they postpone the expiration
+of the value.
+
+Tags can be attached to values by 'AddWithOptions()', then 'InvalidateTag()'
+deletes every value carrying a tag, e.g. every session of an user.
+
+The stored values can be enumerated calling 'Range()', 'Keys()' and
+'KeysWithPrefix()', which skip expired values and do not hold the write lock
+while the caller handles them.
+
+The usage statistics of a Cache (hits, misses, additions, evictions by reason,
+current size and byte usage) are returned by 'Stats()'.
+
+Clock
+
+A Clock provides the current time used to expire values and schedules the
+background workers, like the janitor. The 'WithClock()' option replaces the
+system clock, e.g. by a FakeClock whose time only changes when 'Advance()' is
+called, firing due janitor runs synchronously. Then expiration can be tested
+without waiting.
+
+TypedCache
+
+A TypedCache is a Cache where the types of keys and values are defined by type
+parameters, then values can be read without type assertion. Actually, the Cache
+type is a TypedCache which stores any value by string keys.
+
+ShardedCache
+
+A ShardedCache provides the same operations of Cache, but it distributes the
+keys across independently locked segments to reduce lock contention under
+concurrent workloads.
+
+TieredCache
+
+A TieredCache places an in-memory Cache (L1) in front of a slower Store (L2),
+like a FileStore. Values missing on L1 are read from L2 and stored into L1,
+then values evicted from L1 are still available. The changes are written
+through L2 by default, or written behind in batches by a background worker
+when 'WithWriteBehind()' option is passed to 'NewTieredCache()'.
+
+InvalidationBus
+
+An InvalidationBus broadcasts invalidation messages between caches, e.g. the
+caches of several replicas of a service. A Cache connected to a bus by the
+'WithInvalidationBus()' option broadcasts its 'Delete()', 'Set()' and 'Flush()'
+calls, then peer caches remove their own copy of affected values. A LocalBus
+connects caches of same process and a TCPBus connects caches through network.
+The TCPBus sends messages in background, dropping them when a peer falls too
+far behind.
+
+Store
+
+A Store defines the operations shared by key:value storages whose values expire
+after defined duration of time. Cache and ShardedCache are in-memory stores,
+while FileStore appends every change to a log file which is replayed when it is
+opened, then its values survive restarts.
 */
 package data
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+)
+
+// A LoaderPanicError represents an error when the function that loads a value
+// panics. It is returned to the callers that waited for that load.
+type LoaderPanicError string
+
+// Error returns string representation of current instance error.
+func (e LoaderPanicError) Error() string {
+	return fmt.Sprintf(
+		"Could not load the '%s' key because the loader panicked", string(e))
+}
+
+// A SnapshotVersionError represents an error when a snapshot was written by an
+// unsupported format version.
+type SnapshotVersionError int
+
+// Error returns string representation of current instance error.
+func (e SnapshotVersionError) Error() string {
+	return fmt.Sprintf(
+		"Could not read the snapshot because its version %d is not supported",
+		int(e))
+}
+
+// A NotIntegerError represents an error when the value of a key to increment or
+// decrement is not a signed integer.
+type NotIntegerError string
+
+// Error returns string representation of current instance error.
+func (e NotIntegerError) Error() string {
+	return fmt.Sprintf(
+		"Could not change the '%s' key because its value is not an integer",
+		string(e))
+}
+
+// An OverflowError represents an error when incrementing or decrementing the
+// value of a key would overflow its integer type.
+type OverflowError string
+
+// Error returns string representation of current instance error.
+func (e OverflowError) Error() string {
+	return fmt.Sprintf(
+		"Could not change the '%s' key because its value would overflow",
+		string(e))
+}
+
+// A PeerQueueFullError represents an error when a message could not be queued
+// to a peer because its queue is full. The message is dropped for that peer.
+type PeerQueueFullError string
+
+// Error returns string representation of current instance error.
+func (e PeerQueueFullError) Error() string {
+	return fmt.Sprintf(
+		"Could not send the message to the '%s' peer because its queue is full",
+		string(e))
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// An EvictionPolicy defines which cached value should be discarded when a Cache
+// reaches its maximum capacity.
+//
+// The Cache calls EvictionPolicy methods with its write lock held, then the
+// implementations do not need to be thread-safe. The keys are the same keys
+// stored by the Cache.
+type EvictionPolicy interface {
+	// Added notifies that a new key was stored.
+	Added(key interface{})
+	// Accessed notifies that a stored key was read or modified.
+	Accessed(key interface{})
+	// Removed notifies that a key was removed.
+	Removed(key interface{})
+	// Victim returns the key that should be evicted first.
+	Victim() (key interface{}, ok bool)
+}
+
+// NewLRUPolicy creates a new EvictionPolicy that evicts the least recently used
+// key.
+func NewLRUPolicy() EvictionPolicy {
+	return &listPolicy{
+		elements:     make(map[interface{}]*list.Element),
+		order:        list.New(),
+		moveOnAccess: true,
+	}
+}
+
+// NewFIFOPolicy creates a new EvictionPolicy that evicts the oldest stored key,
+// regardless of how it is used.
+func NewFIFOPolicy() EvictionPolicy {
+	return &listPolicy{
+		elements: make(map[interface{}]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// NewLFUPolicy creates a new EvictionPolicy that evicts the least frequently
+// used key. The oldest key is evicted when more than one key has the same
+// frequency.
+func NewLFUPolicy() EvictionPolicy {
+	return &lfuPolicy{
+		entries: make(map[interface{}]*lfuEntry),
+	}
+}
+
+// A listPolicy represents a LRU or FIFO eviction policy. The front of the list
+// is the next key to evict.
+type listPolicy struct {
+	elements     map[interface{}]*list.Element
+	order        *list.List
+	moveOnAccess bool
+}
+
+func (p *listPolicy) Added(key interface{}) {
+	p.elements[key] = p.order.PushBack(key)
+}
+
+func (p *listPolicy) Accessed(key interface{}) {
+	if !p.moveOnAccess {
+		return
+	}
+	if e, ok := p.elements[key]; ok {
+		p.order.MoveToBack(e)
+	}
+}
+
+func (p *listPolicy) Removed(key interface{}) {
+	if e, ok := p.elements[key]; ok {
+		p.order.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *listPolicy) Victim() (interface{}, bool) {
+	e := p.order.Front()
+	if e == nil {
+		return nil, false
+	}
+	return e.Value, true
+}
+
+// A lfuEntry represents the usage frequency of a key.
+type lfuEntry struct {
+	key   interface{}
+	freq  uint64
+	seq   uint64
+	index int
+}
+
+// A lfuPolicy represents a LFU eviction policy backed by a min-heap of usage
+// frequency.
+type lfuPolicy struct {
+	entries map[interface{}]*lfuEntry
+	heap    lfuHeap
+	seq     uint64
+}
+
+func (p *lfuPolicy) Added(key interface{}) {
+	p.seq++
+	e := &lfuEntry{key: key, freq: 1, seq: p.seq}
+	p.entries[key] = e
+	heap.Push(&p.heap, e)
+}
+
+func (p *lfuPolicy) Accessed(key interface{}) {
+	if e, ok := p.entries[key]; ok {
+		e.freq++
+		heap.Fix(&p.heap, e.index)
+	}
+}
+
+func (p *lfuPolicy) Removed(key interface{}) {
+	if e, ok := p.entries[key]; ok {
+		heap.Remove(&p.heap, e.index)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfuPolicy) Victim() (interface{}, bool) {
+	if len(p.heap) == 0 {
+		return nil, false
+	}
+	return p.heap[0].key, true
+}
+
+// A lfuHeap represents a min-heap of lfuEntry ordered by frequency and then by
+// insertion order. It implements heap.Interface.
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int {
+	return len(h)
+}
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func testEviction(
+	t *testing.T,
+	newPolicy func() EvictionPolicy,
+	access []string,
+	expected string,
+) {
+	ts := NewCache(time.Minute, WithCapacity(3, newPolicy))
+
+	evicted := make([]string, 0)
+	ts.SetEvictionHook(func(key string, value interface{}) {
+		evicted = append(evicted, key)
+	})
+
+	for _, k := range []string{"v1", "v2", "v3"} {
+		if err := ts.Add(k, nil); err != nil {
+			t.Fatalf("The value %s could not be added", k)
+		}
+	}
+	for _, k := range access {
+		ts.Get(k)
+	}
+
+	if err := ts.Add("v4", nil); err != nil {
+		t.Fatal("The value v4 could not be added")
+	}
+	if ts.Count() != 3 {
+		t.Errorf("The cache should hold 3 values, but it has %d", ts.Count())
+	}
+	if _, err := ts.Get(expected); err == nil {
+		t.Errorf("The value %s should be evicted", expected)
+	}
+	if len(evicted) != 1 || evicted[0] != expected {
+		t.Errorf("The eviction hook should report %s, got %v",
+			expected, evicted)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	testEviction(t, NewLRUPolicy, []string{"v1", "v3", "v2"}, "v1")
+	testEviction(t, NewLRUPolicy, []string{"v2", "v1"}, "v3")
+}
+
+func TestLFUEviction(t *testing.T) {
+	testEviction(t, NewLFUPolicy, []string{"v1", "v1", "v3"}, "v2")
+	testEviction(t, NewLFUPolicy, []string{"v3", "v2", "v1"}, "v1")
+}
+
+func TestFIFOEviction(t *testing.T) {
+	testEviction(t, NewFIFOPolicy, []string{"v1", "v1", "v1"}, "v1")
+}
+
+func TestEvictionAfterFlush(t *testing.T) {
+	ts := NewCache(time.Minute, WithCapacity(2, nil))
+
+	ts.Add("v1", nil)
+	ts.Add("v2", nil)
+	ts.Flush()
+	ts.Add("v3", nil)
+	ts.Add("v4", nil)
+
+	if ts.Count() != 2 {
+		t.Errorf("The cache should hold 2 values, but it has %d", ts.Count())
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	ts := NewCache(time.Millisecond*10,
+		WithCapacity(3, NewFIFOPolicy), WithClock(clock))
+
+	reasons := make(map[string]EvictReason)
+	ts.OnEvicted(func(key string, value interface{}, reason EvictReason) {
+		// Must not deadlock
+		ts.Count()
+		reasons[key] = reason
+	})
+
+	ts.Add("v1", nil)
+	ts.Add("v2", nil)
+	ts.Add("v3", nil)
+	ts.Add("v4", nil)
+	ts.Delete("v2")
+	ts.SetLifetime("v4", time.Minute)
+
+	clock.Advance(time.Millisecond * 20)
+	ts.Count()
+	ts.Add("v5", nil)
+	ts.Flush()
+
+	expected := map[string]EvictReason{
+		"v1": EvictCapacity,
+		"v2": EvictDeleted,
+		"v3": EvictExpired,
+		"v4": EvictFlushed,
+		"v5": EvictFlushed,
+	}
+	for k, v := range expected {
+		if r, ok := reasons[k]; !ok || r != v {
+			t.Errorf("The value %s should be evicted as %v, got %v",
+				k, v, r)
+		}
+	}
+}
+
+func TestOnEvictedDeadline(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	ts := NewCache(time.Minute, WithClock(clock))
+
+	reasons := make(map[string]EvictReason)
+	ts.OnEvicted(func(key string, value interface{}, reason EvictReason) {
+		reasons[key] = reason
+	})
+
+	ts.AddWithOptions("v1", nil, ItemOptions{
+		Lifetime: time.Minute,
+		Deadline: testEpoch.Add(time.Second * 90),
+	})
+	ts.AddWithOptions("v2", nil, ItemOptions{
+		Lifetime: time.Minute,
+		Deadline: testEpoch.Add(time.Hour),
+	})
+	ts.Add("v3", nil)
+	ts.SetDeadline("v3", testEpoch.Add(time.Second*30))
+
+	clock.Advance(time.Second * 50)
+	ts.Get("v1")
+	ts.Get("v2")
+
+	// The values are removed long after they expire
+	clock.Advance(time.Hour * 2)
+	ts.Count()
+
+	expected := map[string]EvictReason{
+		"v1": EvictDeadline,
+		"v2": EvictExpired,
+		"v3": EvictDeadline,
+	}
+	for k, v := range expected {
+		if r, ok := reasons[k]; !ok || r != v {
+			t.Errorf("The value %s should be evicted as %v, got %v",
+				k, v, r)
+		}
+	}
+}
+
+// A sizedValue represents a cached value that reports its own size.
+type sizedValue int
+
+func (v sizedValue) Size() int {
+	return int(v)
+}
+
+func TestMaxBytesEviction(t *testing.T) {
+	ts := NewCache(time.Minute, WithMaxBytes(10, nil))
+
+	ts.Add("v1", sizedValue(4))
+	ts.Add("v2", sizedValue(4))
+	ts.Get("v1")
+	if bytes := ts.Stats().Bytes; bytes != 8 {
+		t.Errorf("The cache should use 8 bytes, but it uses %d", bytes)
+	}
+
+	ts.Add("v3", sizedValue(4))
+	if _, err := ts.Get("v2"); err == nil {
+		t.Error("The least recently used value v2 should be evicted")
+	}
+	if bytes := ts.Stats().Bytes; bytes != 8 {
+		t.Errorf("The cache should use 8 bytes, but it uses %d", bytes)
+	}
+
+	ts.Set("v3", sizedValue(8))
+	if _, err := ts.Get("v1"); err == nil {
+		t.Error("The value v1 should be evicted when v3 grows")
+	}
+	if bytes := ts.Stats().Bytes; bytes != 8 {
+		t.Errorf("The cache should use 8 bytes, but it uses %d", bytes)
+	}
+
+	ts.Delete("v3")
+	if bytes := ts.Stats().Bytes; bytes != 0 {
+		t.Errorf("The cache should use no bytes, but it uses %d", bytes)
+	}
+}
+
+func TestSizerEviction(t *testing.T) {
+	ts := NewCache(time.Minute,
+		WithCapacity(0, NewFIFOPolicy),
+		WithMaxBytes(8, func(value interface{}) int {
+			return len(value.(string))
+		}))
+
+	ts.Add("v1", "abc")
+	ts.Add("v2", "abc")
+	ts.Get("v1")
+	ts.Add("v3", "abcd")
+
+	if _, err := ts.Get("v1"); err == nil {
+		t.Error("The oldest value v1 should be evicted")
+	}
+	if ts.Count() != 2 {
+		t.Errorf("The cache should hold 2 values, but it has %d", ts.Count())
+	}
+	if bytes := ts.Stats().Bytes; bytes != 7 {
+		t.Errorf("The cache should use 7 bytes, but it uses %d", bytes)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+// An EvictReason represents the reason why a value was removed from a Cache.
+type EvictReason int
+
+const (
+	// The value was not used during its lifetime.
+	EvictExpired EvictReason = iota
+	// The value was explicitly deleted.
+	EvictDeleted
+	// The value was removed by a cache flush.
+	EvictFlushed
+	// The value was discarded because the cache is full.
+	EvictCapacity
+	// The value reached its absolute deadline.
+	EvictDeadline
+)
+
+// String returns string representation of current instance.
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	case EvictFlushed:
+		return "flushed"
+	case EvictCapacity:
+		return "capacity"
+	case EvictDeadline:
+		return "deadline"
+	default:
+		return "unknown"
+	}
+}
+
+// An EvictedFunc represents a function that is called when a value is removed
+// from a TypedCache.
+type EvictedFunc[K comparable, V any] func(key K, value V, reason EvictReason)
+
+// An eviction represents a pending notification of a removed value.
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+// An expirationHeap represents a min-heap of cached items ordered by their
+// expiration time. It implements heap.Interface.
+type expirationHeap[K comparable, V any] []*cacheItem[K, V]
+
+// Len returns the number of items into current heap.
+func (h expirationHeap[K, V]) Len() int {
+	return len(h)
+}
+
+// Less returns whether the item i expires before the item j.
+func (h expirationHeap[K, V]) Less(i, j int) bool {
+	return h[i].expireAt.Before(h[j].expireAt)
+}
+
+// Swap swaps the items i and j.
+func (h expirationHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+// Push appends a new item to current heap.
+func (h *expirationHeap[K, V]) Push(x interface{}) {
+	item := x.(*cacheItem[K, V])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+// Pop removes the last item from current heap.
+func (h *expirationHeap[K, V]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// Peek returns the item that expires first without removing it.
+func (h expirationHeap[K, V]) Peek() *cacheItem[K, V] {
+	if len(h) == 0 {
+		return nil
+	}
+	return h[0]
+}
@@ -0,0 +1,437 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/skarllot/raiqub"
+)
+
+const (
+	// Defines the minimum number of log records before a FileStore is
+	// automatically compacted.
+	FILESTORE_COMPACT_MIN = 1024
+)
+
+// Defines the operations recorded into FileStore log.
+const (
+	logPut byte = iota + 1
+	logTouch
+	logDelete
+)
+
+// A logRecord represents an operation recorded into FileStore log.
+type logRecord struct {
+	Op       byte
+	Key      string
+	Value    interface{}
+	Lifetime time.Duration
+	ExpireAt time.Time
+}
+
+// A fileEntry represents a value stored by FileStore.
+type fileEntry struct {
+	value    interface{}
+	lifetime time.Duration
+	expireAt time.Time
+}
+
+// A FileStore provides a file-backed key:value storage that expires after
+// defined duration of time.
+//
+// Every change is appended to a log file which is replayed when the FileStore
+// is opened, then the stored values survive restarts. The log is rewritten to
+// contain only live values when it grows too much (see Compact).
+//
+// The values are encoded using gob, then concrete types stored as interface
+// values must be registered calling gob.Register.
+type FileStore struct {
+	path     string
+	file     *os.File
+	values   map[string]*fileEntry
+	lifetime time.Duration
+	records  int
+	err      error
+	clock    Clock
+	sync.Mutex
+}
+
+// NewFileStore opens, or creates, the log file defined by path and defines the
+// default lifetime for new stored values. Only the WithClock option is
+// supported.
+func NewFileStore(
+	path string,
+	d time.Duration,
+	opts ...CacheOption,
+) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		path:     path,
+		file:     f,
+		values:   make(map[string]*fileEntry),
+		lifetime: d,
+		clock:    newCacheOptions(opts).clock,
+	}
+
+	size, err := s.replay()
+	if err == nil {
+		// Discards an incomplete record left by an interrupted write
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Add adds a new key:value to current FileStore instance.
+//
+// Errors:
+// DuplicatedKeyError when requested key already exists.
+func (s *FileStore) Add(key string, value interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.get(key); ok {
+		return raiqub.DuplicatedKeyError(key)
+	}
+
+	e := &fileEntry{
+		value:    value,
+		lifetime: s.lifetime,
+		expireAt: s.clock.Now().Add(s.lifetime),
+	}
+	if err := s.write(logPut, key, e); err != nil {
+		return err
+	}
+
+	s.values[key] = e
+	s.autoCompact()
+	return nil
+}
+
+// Close closes the log file. Returns the first error, if any, that occurred
+// writing a log record or compacting the log file that could not be reported by
+// the operation.
+func (s *FileStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	err := s.file.Close()
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
+
+// Compact rewrites the log file to contain only live values.
+func (s *FileStore) Compact() error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.compact()
+}
+
+// Count gets the number of stored values by current instance.
+func (s *FileStore) Count() int {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.clock.Now()
+	for k, e := range s.values {
+		if now.After(e.expireAt) {
+			delete(s.values, k)
+		}
+	}
+	return len(s.values)
+}
+
+// Delete deletes the specified key:value.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *FileStore) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.get(key)
+	if !ok {
+		return raiqub.InvalidKeyError(key)
+	}
+	if err := s.write(logDelete, key, e); err != nil {
+		return err
+	}
+
+	delete(s.values, key)
+	s.autoCompact()
+	return nil
+}
+
+// Flush deletes any stored value into current instance.
+func (s *FileStore) Flush() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.values = make(map[string]*fileEntry)
+	if err := s.compact(); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// Get gets the value stored by specified key.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *FileStore) Get(key string) (interface{}, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.get(key)
+	if !ok {
+		return nil, raiqub.InvalidKeyError(key)
+	}
+
+	e.expireAt = s.clock.Now().Add(e.lifetime)
+	if err := s.write(logTouch, key, e); err != nil && s.err == nil {
+		s.err = err
+	}
+	s.autoCompact()
+	return e.value, nil
+}
+
+// Set sets the value of specified key.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *FileStore) Set(key string, value interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.get(key)
+	if !ok {
+		return raiqub.InvalidKeyError(key)
+	}
+
+	changed := *e
+	changed.value = value
+	changed.expireAt = s.clock.Now().Add(e.lifetime)
+	if err := s.write(logPut, key, &changed); err != nil {
+		return err
+	}
+
+	*e = changed
+	s.autoCompact()
+	return nil
+}
+
+// SetLifetime modifies the lifetime of specified key:value.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *FileStore) SetLifetime(key string, d time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.get(key)
+	if !ok {
+		return raiqub.InvalidKeyError(key)
+	}
+
+	changed := *e
+	changed.lifetime = d
+	changed.expireAt = s.clock.Now().Add(d)
+	if err := s.write(logTouch, key, &changed); err != nil {
+		return err
+	}
+
+	*e = changed
+	s.autoCompact()
+	return nil
+}
+
+// TTL returns the remaining time until specified key:value expires. Unlike
+// Get, it does not postpone the expiration nor write to the log file.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *FileStore) TTL(key string) (time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.get(key)
+	if !ok {
+		return 0, raiqub.InvalidKeyError(key)
+	}
+	return e.expireAt.Sub(s.clock.Now()), nil
+}
+
+// autoCompact compacts the log file when most of its records are obsolete. It
+// must be called after the change of values is applied, then the compacted log
+// contains the change. Must be called with lock held.
+func (s *FileStore) autoCompact() {
+	if s.records <= FILESTORE_COMPACT_MIN || s.records <= 2*len(s.values) {
+		return
+	}
+	if err := s.compact(); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// compact rewrites the log file to contain only live values. Must be called
+// with lock held.
+func (s *FileStore) compact() error {
+	now := s.clock.Now()
+	records := 0
+	err := writeFile(s.path, func(w io.Writer) error {
+		for k, e := range s.values {
+			if now.After(e.expireAt) {
+				continue
+			}
+			if err := writeRecord(w, logPut, k, e); err != nil {
+				return err
+			}
+			records++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.file.Close()
+	s.file = f
+	s.records = records
+	return nil
+}
+
+// get gets the live entry stored by specified key. Must be called with lock
+// held.
+func (s *FileStore) get(key string) (*fileEntry, bool) {
+	e, ok := s.values[key]
+	if !ok {
+		return nil, false
+	}
+	if s.clock.Now().After(e.expireAt) {
+		delete(s.values, key)
+		return nil, false
+	}
+	return e, true
+}
+
+// replay reads the log file and applies its records. Returns the size of the
+// log up to its last complete record.
+func (s *FileStore) replay() (int64, error) {
+	r := bufio.NewReader(s.file)
+	var size int64
+
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return size, nil
+			}
+			return 0, err
+		}
+
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return size, nil
+			}
+			return 0, err
+		}
+
+		var rec logRecord
+		if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&rec); err != nil {
+			return 0, err
+		}
+
+		switch rec.Op {
+		case logPut:
+			s.values[rec.Key] = &fileEntry{
+				value:    rec.Value,
+				lifetime: rec.Lifetime,
+				expireAt: rec.ExpireAt,
+			}
+		case logTouch:
+			if e, ok := s.values[rec.Key]; ok {
+				e.lifetime = rec.Lifetime
+				e.expireAt = rec.ExpireAt
+			}
+		case logDelete:
+			delete(s.values, rec.Key)
+		}
+
+		size += int64(4 + length)
+		s.records++
+	}
+}
+
+// write appends a record to the log file. Must be called with lock held.
+func (s *FileStore) write(op byte, key string, e *fileEntry) error {
+	if err := writeRecord(s.file, op, key, e); err != nil {
+		return err
+	}
+
+	s.records++
+	return nil
+}
+
+// writeRecord writes a length-prefixed log record to w.
+func writeRecord(w io.Writer, op byte, key string, e *fileEntry) error {
+	rec := logRecord{
+		Op:       op,
+		Key:      key,
+		Lifetime: e.lifetime,
+		ExpireAt: e.expireAt,
+	}
+	if op == logPut {
+		rec.Value = e.value
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 0, 0, 0})
+	if err := gob.NewEncoder(&buf).Encode(&rec); err != nil {
+		return err
+	}
+
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	_, err := w.Write(b)
+	return err
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	count := 0
+	testStore(t, func(d time.Duration, clock Clock) Store {
+		count++
+		path := filepath.Join(dir, strconv.Itoa(count)+".log")
+		s, err := NewFileStore(path, d, WithClock(clock))
+		if err != nil {
+			t.Fatalf("The file store could not be created: %v", err)
+		}
+		return s
+	})
+}
+
+func TestFileStoreReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store.log")
+
+	s, err := NewFileStore(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add("v1", 1)
+	s.Add("v2", 2)
+	s.Add("v3", 3)
+	s.Set("v2", 20)
+	s.Delete("v3")
+	s.SetLifetime("v1", time.Hour)
+	if err := s.Close(); err != nil {
+		t.Fatalf("The file store could not be closed: %v", err)
+	}
+
+	// Simulates an interrupted write
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte{0, 0, 1})
+	f.Close()
+
+	s, err = NewFileStore(path, time.Minute)
+	if err != nil {
+		t.Fatalf("The file store could not be reopened: %v", err)
+	}
+	if s.Count() != 2 {
+		t.Errorf("The file store should restore 2 values, got %d", s.Count())
+	}
+	if v, err := s.Get("v2"); err != nil || v != 20 {
+		t.Error("The changed value v2 was not restored")
+	}
+	if _, err := s.Get("v3"); err == nil {
+		t.Error("The deleted value v3 should not be restored")
+	}
+
+	if err := s.Compact(); err != nil {
+		t.Fatalf("The file store could not be compacted: %v", err)
+	}
+	s.Add("v4", 4)
+	s.Close()
+
+	s, err = NewFileStore(path, time.Minute)
+	if err != nil {
+		t.Fatalf("The compacted file store could not be reopened: %v", err)
+	}
+	defer s.Close()
+	if s.Count() != 3 || s.records != 3 {
+		t.Errorf("The compacted log should hold 3 records, got %d", s.records)
+	}
+	if v, err := s.Get("v1"); err != nil || v != 1 {
+		t.Error("The value v1 was not restored after compaction")
+	}
+}
+
+func TestFileStoreAutoCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testValues := []struct {
+		name   string
+		change func(s *FileStore) error
+		key    string
+		exists bool
+	}{
+		{"Add", func(s *FileStore) error { return s.Add("v2", 2) }, "v2", true},
+		{"Delete", func(s *FileStore) error { return s.Delete("v1") },
+			"v1", false},
+		{"Set", func(s *FileStore) error { return s.Set("v1", 10) }, "v1", true},
+	}
+
+	for _, v := range testValues {
+		path := filepath.Join(dir, v.name+".log")
+		s, err := NewFileStore(path, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Add("v1", 1)
+		for s.records < FILESTORE_COMPACT_MIN {
+			s.Get("v1")
+		}
+
+		// The change crosses the compaction threshold
+		if err := v.change(s); err != nil {
+			t.Fatalf("%s: The value could not be changed: %v", v.name, err)
+		}
+		if s.records > FILESTORE_COMPACT_MIN {
+			t.Errorf("%s: The log should be compacted", v.name)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("%s: The file store could not be closed: %v", v.name, err)
+		}
+
+		s, err = NewFileStore(path, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: The file store could not be reopened: %v", v.name, err)
+		}
+		value, err := s.Get(v.key)
+		if (err == nil) != v.exists {
+			t.Errorf("%s: The change of %s was lost by compaction",
+				v.name, v.key)
+		}
+		if v.name == "Set" && value != 10 {
+			t.Errorf("%s: The value of v1 should be 10, got %v", v.name, value)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"sync"
+	"time"
+)
+
+// A janitor represents a background worker that periodically calls a function,
+// e.g. to remove expired values from a cache.
+type janitor struct {
+	stop func()
+	once sync.Once
+}
+
+// startJanitor starts a new janitor that calls f every interval as defined by
+// specified clock.
+func startJanitor(clock Clock, interval time.Duration, f func()) *janitor {
+	return &janitor{
+		stop: clock.Tick(interval, f),
+	}
+}
+
+// Stop stops current janitor. It is safe to call Stop more than once.
+func (j *janitor) Stop() {
+	j.once.Do(j.stop)
+}
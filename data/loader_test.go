@@ -0,0 +1,124 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrAdd(t *testing.T) {
+	ts := NewCache(time.Minute)
+
+	var calls int32
+	load := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond * 10)
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := ts.GetOrAdd("v1", load); err != nil || v != 42 {
+				t.Errorf("The value v1 was loaded incorrectly: %v", v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("The value v1 should be loaded once, but it was %d times",
+			calls)
+	}
+	if v, err := ts.Get("v1"); err != nil || v != 42 {
+		t.Error("The loaded value v1 was not stored")
+	}
+
+	loadErr := errors.New("load failed")
+	if _, err := ts.GetOrAdd("v2", func() (interface{}, error) {
+		return nil, loadErr
+	}); err != loadErr {
+		t.Errorf("The loader error should be returned, got %v", err)
+	}
+	if ts.Count() != 1 {
+		t.Error("The failed value v2 should not be stored")
+	}
+}
+
+func TestGetOrAddConcurrentAdd(t *testing.T) {
+	ts := NewCache(time.Minute)
+
+	v, err := ts.GetOrAdd("v1", func() (interface{}, error) {
+		ts.Add("v1", "other")
+		return "mine", nil
+	})
+	if err != nil || v != "other" {
+		t.Errorf("The value added concurrently should be returned, got %v", v)
+	}
+	if v, err := ts.Get("v1"); err != nil || v != "other" {
+		t.Errorf("The value added concurrently should be kept, got %v", v)
+	}
+}
+
+func TestLoader(t *testing.T) {
+	ts := NewCache(time.Minute)
+
+	if _, err := ts.Get("v1"); err == nil {
+		t.Error("The value v1 should not be found without loader")
+	}
+
+	loads := make(map[string]int)
+	ts.SetLoader(func(key string) (interface{}, error) {
+		loads[key]++
+		return key + "!", nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if v, err := ts.Get("v1"); err != nil || v != "v1!" {
+			t.Errorf("The value v1 was loaded incorrectly: %v", v)
+		}
+	}
+	if loads["v1"] != 1 {
+		t.Errorf("The value v1 should be loaded once, but it was %d times",
+			loads["v1"])
+	}
+}
+
+func TestLoaderPanic(t *testing.T) {
+	ts := NewCache(time.Minute)
+
+	func() {
+		defer func() {
+			recover()
+		}()
+		ts.GetOrAdd("v1", func() (interface{}, error) {
+			panic("load failed")
+		})
+	}()
+
+	if _, err := ts.GetOrAdd("v1", func() (interface{}, error) {
+		return 1, nil
+	}); err != nil {
+		t.Error("The value v1 should be loadable after a loader panic")
+	}
+}
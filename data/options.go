@@ -0,0 +1,109 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"time"
+)
+
+// A CacheOption represents an optional setting applied to a Cache when it is
+// created.
+type CacheOption func(*cacheOptions)
+
+// cacheOptions holds the settings defined by CacheOption functions.
+type cacheOptions struct {
+	janitorInterval time.Duration
+	maxEntries      int
+	maxBytes        int64
+	sizer           Sizer
+	newPolicy       func() EvictionPolicy
+	snapshotPath    string
+	snapshotEvery   time.Duration
+	bus             InvalidationBus
+	clock           Clock
+}
+
+// WithJanitor starts a background worker that removes expired values every
+// interval. The worker is stopped calling Cache.Close().
+func WithJanitor(interval time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.janitorInterval = interval
+	}
+}
+
+// WithCapacity limits the number of values stored by a Cache. When a new value
+// would exceed max entries, the value selected by the policy created by
+// newPolicy is evicted. The LRU policy is used when newPolicy is nil.
+func WithCapacity(max int, newPolicy func() EvictionPolicy) CacheOption {
+	return func(o *cacheOptions) {
+		o.maxEntries = max
+		o.newPolicy = newPolicy
+	}
+}
+
+// WithMaxBytes limits the total size, in bytes, of values stored by a Cache.
+// The size of each value is returned by sizer or, when sizer is nil, by the
+// value itself when it implements Sized; other values have no size. When a new
+// or changed value would exceed max bytes, values selected by the policy
+// defined by WithCapacity (LRU by default) are evicted. A zero max entries can
+// be passed to WithCapacity to only define the policy.
+func WithMaxBytes(max int64, sizer Sizer) CacheOption {
+	return func(o *cacheOptions) {
+		o.maxBytes = max
+		o.sizer = sizer
+	}
+}
+
+// WithSnapshot writes a snapshot of cached values to specified file every
+// interval, and once more when Cache.Close() is called, which returns the error
+// of failed snapshots. The previous snapshot, if any, is not loaded
+// automatically (see Cache.LoadFile).
+func WithSnapshot(path string, interval time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.snapshotPath = path
+		o.snapshotEvery = interval
+	}
+}
+
+// WithInvalidationBus connects a Cache to specified bus. Every Delete, Set and
+// Flush is broadcast to peer caches, which remove their own copy of affected
+// values; and the messages received from peers are applied without being
+// broadcast again.
+func WithInvalidationBus(bus InvalidationBus) CacheOption {
+	return func(o *cacheOptions) {
+		o.bus = bus
+	}
+}
+
+// WithClock defines the Clock used to expire values and to schedule background
+// workers. The system clock is used by default.
+func WithClock(c Clock) CacheOption {
+	return func(o *cacheOptions) {
+		o.clock = c
+	}
+}
+
+// newCacheOptions applies specified options over default settings.
+func newCacheOptions(opts []CacheOption) cacheOptions {
+	o := cacheOptions{
+		clock: NewSystemClock(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"strings"
+)
+
+// A rangeEntry represents a key:value copied from a TypedCache.
+type rangeEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// Range calls f sequentially for each key:value stored by current instance,
+// skipping expired values. If f returns false, Range stops the iteration.
+//
+// The values are copied holding a read lock, then f is called without holding
+// any lock and it can safely call methods of current instance. The expiration
+// of values is not postponed.
+func (s *TypedCache[K, V]) Range(f func(key K, value V) bool) {
+	for _, e := range s.entries(nil) {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Keys returns the keys of all values stored by current instance, skipping
+// expired values.
+func (s *TypedCache[K, V]) Keys() []K {
+	return s.keys(nil)
+}
+
+// KeysWithPrefix returns the keys, which string representation starts with
+// specified prefix, of all values stored by current instance, skipping expired
+// values.
+func (s *TypedCache[K, V]) KeysWithPrefix(prefix string) []K {
+	return s.keys(func(key K) bool {
+		return strings.HasPrefix(keyString(key), prefix)
+	})
+}
+
+// entries copies the live key:value pairs accepted by match, or all when match
+// is nil.
+func (s *TypedCache[K, V]) entries(match func(K) bool) []rangeEntry[K, V] {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := s.clock.Now()
+	list := make([]rangeEntry[K, V], 0, len(s.values))
+	for k, i := range s.values {
+		if i.IsExpired(now) || (match != nil && !match(k)) {
+			continue
+		}
+		list = append(list, rangeEntry[K, V]{k, i.value})
+	}
+	return list
+}
+
+// keys copies the live keys accepted by match, or all when match is nil.
+func (s *TypedCache[K, V]) keys(match func(K) bool) []K {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := s.clock.Now()
+	list := make([]K, 0, len(s.values))
+	for k, i := range s.values {
+		if i.IsExpired(now) || (match != nil && !match(k)) {
+			continue
+		}
+		list = append(list, k)
+	}
+	return list
+}
@@ -0,0 +1,437 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"io"
+	"time"
+)
+
+// A ShardedCache provides in-memory key:value cache that expires after defined
+// duration of time. Its keys are distributed across independently locked Cache
+// segments, then concurrent operations on distinct keys do not wait each other.
+type ShardedCache struct {
+	shards       []*Cache
+	janitor      *janitor
+	snapshots    *janitor
+	snapshotPath string
+	snapshotErr  snapshotError
+	bus          *busLink
+}
+
+// NewShardedCache creates a new instance of ShardedCache with n segments and
+// defines the default lifetime for new cached items.
+//
+// The capacity defined by WithCapacity is split among segments, then each
+// segment evicts its own values.
+func NewShardedCache(
+	n int,
+	d time.Duration,
+	opts ...CacheOption,
+) *ShardedCache {
+	if n < 1 {
+		n = 1
+	}
+
+	o := newCacheOptions(opts)
+
+	shardOpts := make([]CacheOption, 0, len(opts)+1)
+	shardOpts = append(shardOpts, opts...)
+	shardOpts = append(shardOpts, func(so *cacheOptions) {
+		so.janitorInterval = 0
+		so.snapshotPath = ""
+		so.bus = nil
+		if so.maxEntries > 0 {
+			so.maxEntries = (so.maxEntries + n - 1) / n
+		}
+		if so.maxBytes > 0 {
+			so.maxBytes = (so.maxBytes + int64(n) - 1) / int64(n)
+		}
+	})
+
+	c := &ShardedCache{
+		shards: make([]*Cache, n),
+	}
+	for i := range c.shards {
+		c.shards[i] = NewCache(d, shardOpts...)
+	}
+
+	if o.janitorInterval > 0 {
+		c.janitor = startJanitor(o.clock, o.janitorInterval, c.sweep)
+	}
+
+	if o.snapshotPath != "" && o.snapshotEvery > 0 {
+		c.snapshotPath = o.snapshotPath
+		c.snapshots = startJanitor(o.clock, o.snapshotEvery, func() {
+			c.snapshotErr.Set(c.SaveFile(c.snapshotPath))
+		})
+	}
+
+	if o.bus != nil {
+		c.bus = newBusLink(o.bus, c.receive)
+	}
+
+	return c
+}
+
+// Add adds a new key:value to current ShardedCache instance.
+//
+// Errors:
+// DuplicatedKeyError when requested key already exists.
+func (s *ShardedCache) Add(key string, value interface{}) error {
+	return s.shard(key).Add(key, value)
+}
+
+// AddWithOptions adds a new key:value to current ShardedCache instance using
+// specified expiration settings (see Cache.AddWithOptions).
+//
+// Errors:
+// DuplicatedKeyError when requested key already exists.
+func (s *ShardedCache) AddWithOptions(
+	key string,
+	value interface{},
+	opts ItemOptions,
+) error {
+	return s.shard(key).AddWithOptions(key, value, opts)
+}
+
+// Close stops the background janitor, if any. When periodic snapshots are
+// enabled, they are stopped and a last snapshot is written. Returns the error
+// of the last snapshot or, when it succeeds, of the last failed periodic
+// snapshot. It is safe to call Close more than once.
+func (s *ShardedCache) Close() error {
+	if s.janitor != nil {
+		s.janitor.Stop()
+	}
+	s.bus.Close()
+	if s.snapshots != nil {
+		s.snapshots.Stop()
+		if err := s.SaveFile(s.snapshotPath); err != nil {
+			return err
+		}
+		return s.snapshotErr.Err()
+	}
+	return nil
+}
+
+// CompareAndSwap sets the value of specified key to new when its current value
+// is equal to old (see Cache.CompareAndSwap).
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *ShardedCache) CompareAndSwap(
+	key string,
+	old, new interface{},
+) (bool, error) {
+	swapped, err := s.shard(key).CompareAndSwap(key, old, new)
+	if swapped {
+		s.bus.Publish(InvalidateKey, key)
+	}
+	return swapped, err
+}
+
+// Count gets the number of cached values by current instance.
+func (s *ShardedCache) Count() int {
+	count := 0
+	for _, c := range s.shards {
+		count += c.Count()
+	}
+	return count
+}
+
+// Decrement subtracts delta from the integer value of specified key and
+// returns the new value (see Cache.Decrement).
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+// NotIntegerError when the value is not a signed integer.
+// OverflowError when the new value does not fit into the value type.
+func (s *ShardedCache) Decrement(key string, delta int64) (int64, error) {
+	n, err := s.shard(key).Decrement(key, delta)
+	if err != nil {
+		return n, err
+	}
+
+	s.bus.Publish(InvalidateKey, key)
+	return n, nil
+}
+
+// Flush deletes any cached value into current instance.
+func (s *ShardedCache) Flush() {
+	for _, c := range s.shards {
+		c.flush()
+	}
+	s.bus.Publish(InvalidateAll, nil)
+}
+
+// Get gets the value cached by specified key. When the key could not be found
+// and a loader is defined by SetLoader, the value is loaded and stored.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found and no loader is
+// defined; or the error returned by loader.
+func (s *ShardedCache) Get(key string) (interface{}, error) {
+	return s.shard(key).Get(key)
+}
+
+// GetOrAdd gets the value cached by specified key or, when it could not be
+// found, adds the value returned by f (see Cache.GetOrAdd).
+//
+// Errors:
+// The error returned by f.
+func (s *ShardedCache) GetOrAdd(
+	key string,
+	f func() (interface{}, error),
+) (interface{}, error) {
+	return s.shard(key).GetOrAdd(key, f)
+}
+
+// Increment adds delta to the integer value of specified key and returns the
+// new value (see Cache.Increment).
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+// NotIntegerError when the value is not a signed integer.
+// OverflowError when the new value does not fit into the value type.
+func (s *ShardedCache) Increment(key string, delta int64) (int64, error) {
+	n, err := s.shard(key).Increment(key, delta)
+	if err != nil {
+		return n, err
+	}
+
+	s.bus.Publish(InvalidateKey, key)
+	return n, nil
+}
+
+// Delete deletes the specified key:value.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *ShardedCache) Delete(key string) error {
+	if err := s.shard(key).delete(key); err != nil {
+		return err
+	}
+
+	s.bus.Publish(InvalidateKey, key)
+	return nil
+}
+
+// InvalidateTag deletes every value carrying specified tag. Returns the number
+// of deleted values.
+func (s *ShardedCache) InvalidateTag(tag string) int {
+	count := 0
+	for _, c := range s.shards {
+		count += c.InvalidateTag(tag)
+	}
+	return count
+}
+
+// OnEvicted registers a function that is called every time a value is removed
+// from current instance (see Cache.OnEvicted).
+func (s *ShardedCache) OnEvicted(f EvictedFunc[string, interface{}]) {
+	for _, c := range s.shards {
+		c.OnEvicted(f)
+	}
+}
+
+// Range calls f sequentially for each key:value stored by current instance,
+// skipping expired values. If f returns false, Range stops the iteration (see
+// Cache.Range).
+func (s *ShardedCache) Range(f func(key string, value interface{}) bool) {
+	for _, c := range s.shards {
+		for _, e := range c.entries(nil) {
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns the keys of all values stored by current instance, skipping
+// expired values.
+func (s *ShardedCache) Keys() []string {
+	var list []string
+	for _, c := range s.shards {
+		list = append(list, c.Keys()...)
+	}
+	return list
+}
+
+// KeysWithPrefix returns the keys starting with specified prefix of all values
+// stored by current instance, skipping expired values.
+func (s *ShardedCache) KeysWithPrefix(prefix string) []string {
+	var list []string
+	for _, c := range s.shards {
+		list = append(list, c.KeysWithPrefix(prefix)...)
+	}
+	return list
+}
+
+// Set sets the value of specified key.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *ShardedCache) Set(key string, value interface{}) error {
+	if err := s.shard(key).set(key, value); err != nil {
+		return err
+	}
+
+	s.bus.Publish(InvalidateKey, key)
+	return nil
+}
+
+// SaveTo writes a snapshot of all cached values to specified writer (see
+// Cache.SaveTo).
+func (s *ShardedCache) SaveTo(w io.Writer) error {
+	var list []snapshotEntry[string, interface{}]
+	for _, c := range s.shards {
+		list = append(list, c.snapshot()...)
+	}
+	return writeSnapshot(w, list)
+}
+
+// LoadFrom reads a snapshot written by SaveTo and adds its values to current
+// instance (see Cache.LoadFrom).
+//
+// Errors:
+// SnapshotVersionError when the snapshot version is not supported.
+func (s *ShardedCache) LoadFrom(r io.Reader) error {
+	return readSnapshot(r, func(e snapshotEntry[string, interface{}]) {
+		s.shard(e.Key).restore(e)
+	})
+}
+
+// SaveFile writes a snapshot of all cached values to specified file (see
+// Cache.SaveFile).
+func (s *ShardedCache) SaveFile(path string) error {
+	return writeFile(path, s.SaveTo)
+}
+
+// LoadFile reads a snapshot from specified file (see Cache.LoadFrom).
+func (s *ShardedCache) LoadFile(path string) error {
+	return readFile(path, s.LoadFrom)
+}
+
+// SetEvictionHook defines a function that is called every time a value is
+// evicted because its segment is full (see Cache.SetEvictionHook).
+func (s *ShardedCache) SetEvictionHook(f func(key string, value interface{})) {
+	for _, c := range s.shards {
+		c.SetEvictionHook(f)
+	}
+}
+
+// SetLoader defines a function that loads the values requested by Get that
+// could not be found (see Cache.SetLoader).
+func (s *ShardedCache) SetLoader(f func(key string) (interface{}, error)) {
+	for _, c := range s.shards {
+		c.SetLoader(f)
+	}
+}
+
+// SetDeadline modifies the absolute deadline of specified key:value (see
+// Cache.SetDeadline).
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *ShardedCache) SetDeadline(key string, t time.Time) error {
+	return s.shard(key).SetDeadline(key, t)
+}
+
+// SetLifetime modifies the lifetime of specified key:value.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *ShardedCache) SetLifetime(key string, d time.Duration) error {
+	return s.shard(key).SetLifetime(key, d)
+}
+
+// Stats returns the usage statistics of current instance, summed up from every
+// segment.
+func (s *ShardedCache) Stats() CacheStats {
+	var stats CacheStats
+	for _, c := range s.shards {
+		stats.Add(c.Stats())
+	}
+	return stats
+}
+
+// TTL returns the remaining time until specified key:value expires.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *ShardedCache) TTL(key string) (time.Duration, error) {
+	return s.shard(key).TTL(key)
+}
+
+// Update sets the value of specified key to the value returned by f (see
+// Cache.Update).
+//
+// Errors:
+// InvalidKeyError when requested key could not be found; or the error returned
+// by f.
+func (s *ShardedCache) Update(
+	key string,
+	f func(old interface{}) (interface{}, error),
+) error {
+	if err := s.shard(key).Update(key, f); err != nil {
+		return err
+	}
+
+	s.bus.Publish(InvalidateKey, key)
+	return nil
+}
+
+// receive applies an invalidation message received from a peer cache.
+func (s *ShardedCache) receive(msg InvalidationMessage) {
+	switch msg.Op {
+	case InvalidateKey:
+		if key, ok := msg.Key.(string); ok {
+			s.shard(key).delete(key)
+		}
+	case InvalidateAll:
+		for _, c := range s.shards {
+			c.flush()
+		}
+	}
+}
+
+// shard returns the segment which holds specified key.
+func (s *ShardedCache) shard(key string) *Cache {
+	return s.shards[fnv32a(key)%uint32(len(s.shards))]
+}
+
+// sweep removes all expired values from every segment.
+func (s *ShardedCache) sweep() {
+	for _, c := range s.shards {
+		c.sweep()
+	}
+}
+
+// fnv32a returns the 32-bit FNV-1a hash of specified string.
+func fnv32a(str string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	hash := uint32(offset32)
+	for i := 0; i < len(str); i++ {
+		hash ^= uint32(str[i])
+		hash *= prime32
+	}
+	return hash
+}
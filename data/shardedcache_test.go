@@ -0,0 +1,61 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShardedStore(t *testing.T) {
+	testStore(t, func(d time.Duration, clock Clock) Store {
+		return NewShardedCache(4, d, WithClock(clock))
+	})
+}
+
+func TestShardedCache(t *testing.T) {
+	ts := NewShardedCache(4, time.Minute, WithCapacity(8, nil))
+
+	for i := 0; i < 100; i++ {
+		ts.Add(strconv.Itoa(i), i)
+	}
+	if count := ts.Count(); count > 8 {
+		t.Errorf("The cache should hold at most 8 values, but it has %d",
+			count)
+	}
+
+	ts.Flush()
+	if err := ts.Add("v1", 1); err != nil {
+		t.Error("The value v1 could not be stored")
+	}
+	if err := ts.Add("v1", 2); err == nil {
+		t.Error("The duplicated v1 could be stored")
+	}
+	if err := ts.Set("v1", 3); err != nil {
+		t.Error("The value v1 could not be changed")
+	}
+	if v, err := ts.Get("v1"); err != nil || v != 3 {
+		t.Error("The value v1 was stored incorrectly")
+	}
+	if err := ts.Delete("v1"); err != nil {
+		t.Error("The value v1 could not be removed")
+	}
+	if ts.Count() != 0 {
+		t.Error("The cache should be empty")
+	}
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+// A Sizer returns the size, in bytes, of specified cached value.
+type Sizer func(value interface{}) int
+
+// A Sized defines a value that reports its own size in bytes.
+type Sized interface {
+	Size() int
+}
+
+// sizeOf returns the size of specified value as reported by sizer, when
+// defined, or by the value itself when it implements Sized. Otherwise the size
+// of the value is zero.
+func sizeOf(sizer Sizer, value interface{}) int64 {
+	if sizer != nil {
+		return int64(sizer(value))
+	}
+	if v, ok := value.(Sized); ok {
+		return int64(v.Size())
+	}
+	return 0
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// Defines the current version of snapshot format.
+	SNAPSHOT_VERSION = 1
+)
+
+// A snapshotHeader represents the beginning of a snapshot stream.
+type snapshotHeader struct {
+	Version int
+}
+
+// A snapshotEntry represents a cached value into a snapshot stream. Times are
+// stored relative to the moment the snapshot was taken.
+type snapshotEntry[K comparable, V any] struct {
+	Key       K
+	Value     V
+	Lifetime  time.Duration
+	Remaining time.Duration
+	// Remaining time until deadline; zero when there is no deadline.
+	Deadline time.Duration
+	Tags     []string
+}
+
+// A snapshotError keeps the last error of periodic snapshots, which could not
+// be reported by the background writer.
+type snapshotError struct {
+	err error
+	sync.Mutex
+}
+
+// Err returns the last error kept, if any.
+func (e *snapshotError) Err() error {
+	e.Lock()
+	defer e.Unlock()
+	return e.err
+}
+
+// Set keeps specified error, if any.
+func (e *snapshotError) Set(err error) {
+	if err == nil {
+		return
+	}
+	e.Lock()
+	e.err = err
+	e.Unlock()
+}
+
+// SaveTo writes a snapshot of all cached values to specified writer. Each value
+// keeps its remaining lifetime.
+//
+// The snapshot is encoded using gob, then concrete types stored as interface
+// values must be registered calling gob.Register.
+func (s *TypedCache[K, V]) SaveTo(w io.Writer) error {
+	return writeSnapshot(w, s.snapshot())
+}
+
+// LoadFrom reads a snapshot written by SaveTo and adds its values to current
+// instance. The values already expired and the keys already stored by current
+// instance are skipped.
+//
+// Errors:
+// SnapshotVersionError when the snapshot version is not supported.
+func (s *TypedCache[K, V]) LoadFrom(r io.Reader) error {
+	return readSnapshot(r, s.restore)
+}
+
+// SaveFile writes a snapshot of all cached values to specified file. The file
+// is replaced atomically, then a failed write does not corrupt the previous
+// snapshot.
+func (s *TypedCache[K, V]) SaveFile(path string) error {
+	return writeFile(path, s.SaveTo)
+}
+
+// LoadFile reads a snapshot from specified file (see LoadFrom).
+func (s *TypedCache[K, V]) LoadFile(path string) error {
+	return readFile(path, s.LoadFrom)
+}
+
+// snapshot returns a snapshotEntry for each cached value.
+func (s *TypedCache[K, V]) snapshot() []snapshotEntry[K, V] {
+	s.Lock()
+	defer s.unlock()
+	s.removeExpired()
+
+	now := s.clock.Now()
+	list := make([]snapshotEntry[K, V], 0, len(s.values))
+	for _, i := range s.values {
+		e := snapshotEntry[K, V]{
+			Key:       i.key,
+			Value:     i.value,
+			Lifetime:  i.lifetime,
+			Remaining: i.expireAt.Sub(now),
+			Tags:      i.tags,
+		}
+		if !i.deadline.IsZero() {
+			e.Deadline = i.deadline.Sub(now)
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// restore adds specified snapshotEntry to current instance.
+func (s *TypedCache[K, V]) restore(e snapshotEntry[K, V]) {
+	s.Lock()
+	defer s.unlock()
+
+	if _, ok := s.values[e.Key]; ok || e.Remaining <= 0 {
+		return
+	}
+
+	now := s.clock.Now()
+	opts := ItemOptions{Lifetime: e.Lifetime, Tags: e.Tags}
+	if e.Deadline > 0 {
+		opts.Deadline = now.Add(e.Deadline)
+	}
+	s.insert(e.Key, e.Value, opts)
+
+	i := s.values[e.Key]
+	i.expireAt = now.Add(e.Remaining)
+	heap.Fix(&s.expiry, i.index)
+}
+
+// writeSnapshot encodes specified entries to w.
+func writeSnapshot[K comparable, V any](
+	w io.Writer,
+	list []snapshotEntry[K, V],
+) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{SNAPSHOT_VERSION}); err != nil {
+		return err
+	}
+	for i := range list {
+		if err := enc.Encode(&list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSnapshot decodes entries from r and calls fn for each one.
+func readSnapshot[K comparable, V any](
+	r io.Reader,
+	fn func(snapshotEntry[K, V]),
+) error {
+	dec := gob.NewDecoder(r)
+
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+	if header.Version != SNAPSHOT_VERSION {
+		return SnapshotVersionError(header.Version)
+	}
+
+	for {
+		var e snapshotEntry[K, V]
+		if err := dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fn(e)
+	}
+}
+
+// writeFile atomically replaces specified file by the content written by fn.
+func writeFile(path string, fn func(io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readFile opens specified file and reads it using fn.
+func readFile(path string, fn func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return fn(f)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	ts := NewCache(time.Minute)
+	ts.Add("v1", 1)
+	ts.Add("v2", "two")
+	ts.AddWithOptions("v3", 3.0, ItemOptions{
+		Deadline: time.Now().Add(time.Hour),
+		Tags:     []string{"t1"},
+	})
+
+	var buf bytes.Buffer
+	if err := ts.SaveTo(&buf); err != nil {
+		t.Fatalf("The snapshot could not be written: %v", err)
+	}
+
+	loaded := NewCache(time.Second)
+	loaded.Add("v1", 10)
+	if err := loaded.LoadFrom(&buf); err != nil {
+		t.Fatalf("The snapshot could not be read: %v", err)
+	}
+
+	if loaded.Count() != 3 {
+		t.Errorf("The snapshot should restore 3 values, got %d",
+			loaded.Count())
+	}
+	if v, _ := loaded.Get("v1"); v != 10 {
+		t.Error("The existing value v1 should not be replaced")
+	}
+	if v, _ := loaded.Get("v2"); v != "two" {
+		t.Error("The value v2 was restored incorrectly")
+	}
+	if ttl, _ := loaded.TTL("v2"); ttl <= time.Second {
+		t.Errorf("The value v2 should keep its lifetime: %v", ttl)
+	}
+	if ttl, _ := loaded.TTL("v3"); ttl <= time.Minute {
+		t.Errorf("The value v3 should keep its deadline: %v", ttl)
+	}
+	if loaded.InvalidateTag("t1") != 1 {
+		t.Error("The value v3 should keep its tags")
+	}
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	var buf bytes.Buffer
+	gob.NewEncoder(&buf).Encode(snapshotHeader{SNAPSHOT_VERSION + 1})
+
+	err := NewCache(time.Minute).LoadFrom(&buf)
+	if _, ok := err.(SnapshotVersionError); !ok {
+		t.Errorf("The unknown snapshot version should be rejected: %v", err)
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.snapshot")
+
+	ts := NewCache(time.Minute, WithSnapshot(path, time.Hour))
+	ts.Add("v1", 1)
+	if err := ts.Close(); err != nil {
+		t.Fatalf("The snapshot could not be written on close: %v", err)
+	}
+
+	loaded := NewCache(time.Minute)
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("The snapshot file could not be read: %v", err)
+	}
+	if v, err := loaded.Get("v1"); err != nil || v != 1 {
+		t.Error("The value v1 was not restored")
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("The temporary snapshot files should be removed: %d files",
+			len(files))
+	}
+}
+
+func TestSnapshotFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	missing := filepath.Join(dir, "missing")
+
+	clock := NewFakeClock(testEpoch)
+	ts := NewCache(time.Minute, WithClock(clock),
+		WithSnapshot(filepath.Join(missing, "cache.snapshot"), time.Second))
+	ts.Add("v1", 1)
+	clock.Advance(time.Second)
+
+	// The last snapshot succeeds, but the periodic one has failed
+	os.Mkdir(missing, 0700)
+	if err := ts.Close(); err == nil {
+		t.Error("The error of periodic snapshot should be returned on close")
+	}
+}
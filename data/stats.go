@@ -0,0 +1,94 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"sync/atomic"
+)
+
+// A CacheStats represents the usage statistics of a cache.
+type CacheStats struct {
+	// Number of lookups that found a value.
+	Hits uint64
+	// Number of lookups that did not find a value.
+	Misses uint64
+	// Number of added values.
+	Adds uint64
+	// Number of removed values by reason.
+	Evictions map[EvictReason]uint64
+	// Number of values currently stored.
+	Size int64
+	// Total size, in bytes, of values currently stored.
+	Bytes int64
+}
+
+// A StatsProvider defines a type that reports its usage statistics.
+type StatsProvider interface {
+	Stats() CacheStats
+}
+
+// EvictReasons returns every known EvictReason.
+func EvictReasons() []EvictReason {
+	return []EvictReason{
+		EvictExpired,
+		EvictDeleted,
+		EvictFlushed,
+		EvictCapacity,
+		EvictDeadline,
+	}
+}
+
+// A cacheCounters represents the atomic counters of cache usage.
+type cacheCounters struct {
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	adds      atomic.Uint64
+	evictions [EvictDeadline + 1]atomic.Uint64
+	size      atomic.Int64
+	bytes     atomic.Int64
+}
+
+// Stats returns a copy of current counters.
+func (c *cacheCounters) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Adds:      c.adds.Load(),
+		Evictions: make(map[EvictReason]uint64, len(c.evictions)),
+		Size:      c.size.Load(),
+		Bytes:     c.bytes.Load(),
+	}
+	for i := range c.evictions {
+		stats.Evictions[EvictReason(i)] = c.evictions[i].Load()
+	}
+	return stats
+}
+
+// Add adds specified statistics to current instance.
+func (s *CacheStats) Add(other CacheStats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Adds += other.Adds
+	s.Size += other.Size
+	s.Bytes += other.Bytes
+	if s.Evictions == nil {
+		s.Evictions = make(map[EvictReason]uint64, len(other.Evictions))
+	}
+	for k, v := range other.Evictions {
+		s.Evictions[k] += v
+	}
+}
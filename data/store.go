@@ -0,0 +1,50 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"time"
+)
+
+// A Store defines the operations of a key:value storage whose values expire
+// after defined duration of time without being used.
+type Store interface {
+	// Add adds a new key:value.
+	Add(key string, value interface{}) error
+	// Count gets the number of stored values.
+	Count() int
+	// Delete deletes the specified key:value.
+	Delete(key string) error
+	// Flush deletes any stored value.
+	Flush()
+	// Get gets the value stored by specified key.
+	Get(key string) (interface{}, error)
+	// Set sets the value of specified key.
+	Set(key string, value interface{}) error
+	// SetLifetime modifies the lifetime of specified key:value.
+	SetLifetime(key string, d time.Duration) error
+	// TTL returns the remaining time until specified key:value expires,
+	// without postponing its expiration.
+	TTL(key string) (time.Duration, error)
+}
+
+var (
+	_ Store = (*Cache)(nil)
+	_ Store = (*ShardedCache)(nil)
+	_ Store = (*FileStore)(nil)
+	_ Store = (*TieredCache)(nil)
+)
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+// A storeFactory creates a new Store which values expire after d, as measured
+// by specified clock.
+type storeFactory func(d time.Duration, clock Clock) Store
+
+// testEpoch defines the initial time of fake clocks used by tests.
+var testEpoch = time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// testStore tests the behaviour shared by every Store implementation.
+func testStore(t *testing.T, newStore storeFactory) {
+	t.Run("ValueExpiration", func(t *testing.T) {
+		testValueExpiration(t, newStore)
+	})
+	t.Run("ValueHandling", func(t *testing.T) {
+		testValueHandling(t, newStore)
+	})
+	t.Run("ValueIdCollision", func(t *testing.T) {
+		testValueIdCollision(t, newStore)
+	})
+	t.Run("ValueSetExpiration", func(t *testing.T) {
+		testValueSetExpiration(t, newStore)
+	})
+	t.Run("ValueTTL", func(t *testing.T) {
+		testValueTTL(t, newStore)
+	})
+}
+
+func testValueExpiration(t *testing.T, newStore storeFactory) {
+	clock := NewFakeClock(testEpoch)
+	ts := newStore(time.Millisecond*10, clock)
+
+	ts.Add("v1", nil)
+	ts.Add("v2", nil)
+
+	if _, err := ts.Get("v1"); err != nil {
+		t.Error("The value v1 was not stored")
+	}
+	if _, err := ts.Get("v2"); err != nil {
+		t.Error("The value v2 was not stored")
+	}
+
+	clock.Advance(time.Millisecond * 20)
+
+	if _, err := ts.Get("v1"); err == nil {
+		t.Error("The value v1 was not expired")
+	}
+	if _, err := ts.Get("v2"); err == nil {
+		t.Error("The value v2 was not expired")
+	}
+
+	if err := ts.Delete("v1"); err == nil {
+		t.Error("The expired value v1 should not be removable")
+	}
+	if err := ts.Set("v2", nil); err == nil {
+		t.Error("The expired value v2 should not be changeable")
+	}
+}
+
+func testValueHandling(t *testing.T, newStore storeFactory) {
+	testValues := map[string]int{
+		"v1":  3,
+		"v2":  6,
+		"v3":  83679,
+		"v4":  2748,
+		"v5":  54,
+		"v6":  6,
+		"v7":  2,
+		"v8":  8,
+		"v9":  7,
+		"v10": 8,
+	}
+	rmTestKey := "v5"
+	changeValues := map[string]int{
+		"v4": 5062,
+		"v9": 4099,
+	}
+
+	ts := newStore(time.Millisecond*10, NewFakeClock(testEpoch))
+
+	for k, v := range testValues {
+		err := ts.Add(k, v)
+		if err != nil {
+			t.Errorf("The value %s could not be added", k)
+		}
+	}
+
+	if ts.Count() != len(testValues) {
+		t.Error("The values count do not match")
+	}
+
+	for k, v := range testValues {
+		v2, err := ts.Get(k)
+		if err != nil {
+			t.Errorf("The value %s could not be read", k)
+		}
+		if v2 != v {
+			t.Errorf("The value %s was stored incorrectly", k)
+		}
+	}
+
+	if err := ts.Delete(rmTestKey); err != nil {
+		t.Errorf("The value %s could not be removed", rmTestKey)
+	}
+	if _, err := ts.Get(rmTestKey); err == nil {
+		t.Errorf("The removed value %s should not be retrieved", rmTestKey)
+	}
+	if ts.Count() == len(testValues) {
+		t.Error("The values count should not match")
+	}
+
+	for k, v := range changeValues {
+		err := ts.Set(k, v)
+		if err != nil {
+			t.Errorf("The value %s could not be changed", k)
+		}
+	}
+	for k, v := range changeValues {
+		v2, err := ts.Get(k)
+		if err != nil {
+			t.Errorf("The value %s could not be read", k)
+		}
+		if v2 != v {
+			t.Errorf("The value %s was not changed", k)
+		}
+	}
+}
+
+func testValueIdCollision(t *testing.T, newStore storeFactory) {
+	ts := newStore(time.Millisecond, NewFakeClock(testEpoch))
+
+	if err := ts.Add("v1", nil); err != nil {
+		t.Error("The value v1 could not be stored")
+	}
+	if err := ts.Add("v1", nil); err == nil {
+		t.Error("The duplicated v1 could be stored")
+	}
+}
+
+func testValueSetExpiration(t *testing.T, newStore storeFactory) {
+	clock := NewFakeClock(testEpoch)
+	ts := newStore(time.Millisecond, clock)
+
+	ts.Add("v1", nil)
+	ts.SetLifetime("v1", time.Second)
+
+	clock.Advance(time.Millisecond * 10)
+
+	if _, err := ts.Get("v1"); err != nil {
+		t.Error("The value v1 is expired before expected")
+	}
+
+	if err := ts.SetLifetime("v2", time.Second); err == nil {
+		t.Error("Should not be possible to set duration for invalid value")
+	}
+}
+
+func testValueTTL(t *testing.T, newStore storeFactory) {
+	clock := NewFakeClock(testEpoch)
+	ts := newStore(time.Minute, clock)
+
+	ts.Add("v1", nil)
+	for expected := time.Second * 40; expected >= 0; expected -= time.Second * 20 {
+		clock.Advance(time.Second * 20)
+		if d, err := ts.TTL("v1"); err != nil || d != expected {
+			t.Errorf("The TTL of v1 should be %v, got %v", expected, d)
+		}
+	}
+
+	clock.Advance(time.Second * 20)
+	if _, err := ts.TTL("v1"); err == nil {
+		t.Error("The value v1 was not expired")
+	}
+	if _, err := ts.TTL("v2"); err == nil {
+		t.Error("The TTL of missing value v2 should not be returned")
+	}
+}
@@ -0,0 +1,331 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"encoding/gob"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Defines the maximum time to wait for a connection to a TCPBus peer.
+	TCPBUS_DIAL_TIMEOUT = time.Second
+	// Defines the maximum time to wait for a message to be written to a TCPBus
+	// peer.
+	TCPBUS_WRITE_TIMEOUT = time.Second
+	// Defines the maximum number of messages waiting to be sent to a TCPBus
+	// peer. Messages are dropped while the queue is full.
+	TCPBUS_QUEUE_SIZE = 1024
+	// Defines the time to wait before reconnecting to a TCPBus peer after a
+	// failure, which doubles on every failure up to TCPBUS_RETRY_MAX.
+	TCPBUS_RETRY_MIN = time.Millisecond * 100
+	// Defines the maximum time to wait before reconnecting to a TCPBus peer.
+	TCPBUS_RETRY_MAX = time.Second * 30
+)
+
+// A TCPBus provides an InvalidationBus that broadcasts messages to peer nodes
+// through TCP connections. Every node listens for messages sent by its peers
+// and delivers them to local subscribers.
+//
+// The messages are sent asynchronously, then a slow or unreachable peer does
+// not block the cache operations.
+//
+// The keys are encoded using gob, then concrete types used as keys, other than
+// basic types, must be registered calling gob.Register.
+type TCPBus struct {
+	listener    net.Listener
+	peers       map[string]*tcpPeer
+	inbound     map[net.Conn]struct{}
+	subscribers map[int]func(InvalidationMessage)
+	next        int
+	closed      bool
+	wg          sync.WaitGroup
+	sync.Mutex
+}
+
+// A tcpPeer represents the connection to a TCPBus peer.
+type tcpPeer struct {
+	addr  string
+	conn  net.Conn
+	enc   *gob.Encoder
+	queue chan InvalidationMessage
+	done  chan struct{}
+	mutex sync.Mutex
+}
+
+// NewTCPBus creates a new instance of TCPBus listening on specified address and
+// connected to specified peer addresses.
+func NewTCPBus(addr string, peers ...string) (*TCPBus, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TCPBus{
+		listener:    l,
+		peers:       make(map[string]*tcpPeer),
+		inbound:     make(map[net.Conn]struct{}),
+		subscribers: make(map[int]func(InvalidationMessage)),
+	}
+	for _, p := range peers {
+		s.AddPeer(p)
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address which current instance is listening.
+func (s *TCPBus) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// AddPeer adds a peer address to broadcast messages. The connection is
+// established on demand.
+func (s *TCPBus) AddPeer(addr string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.peers[addr]; ok || s.closed {
+		return
+	}
+	p := &tcpPeer{
+		addr:  addr,
+		queue: make(chan InvalidationMessage, TCPBUS_QUEUE_SIZE),
+		done:  make(chan struct{}),
+	}
+	s.peers[addr] = p
+	s.wg.Add(1)
+	go p.run(&s.wg)
+}
+
+// Close stops listening for messages and closes all connections.
+func (s *TCPBus) Close() error {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.listener.Close()
+	for c := range s.inbound {
+		c.Close()
+	}
+	peers := s.peerList()
+	s.Unlock()
+
+	for _, p := range peers {
+		p.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// Publish queues specified message to be sent to every peer and delivers it to
+// local subscribers.
+//
+// Errors:
+// PeerQueueFullError when the message was dropped for a peer.
+func (s *TCPBus) Publish(msg InvalidationMessage) error {
+	s.Lock()
+	peers := s.peerList()
+	s.Unlock()
+
+	var firstErr error
+	for _, p := range peers {
+		if err := p.Enqueue(msg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	s.deliver(msg)
+	return firstErr
+}
+
+// Subscribe registers a function that is called for every received message.
+func (s *TCPBus) Subscribe(f func(msg InvalidationMessage)) func() {
+	s.Lock()
+	defer s.Unlock()
+
+	id := s.next
+	s.next++
+	s.subscribers[id] = f
+	return func() {
+		s.Lock()
+		defer s.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// accept accepts connections from peers until current instance is closed.
+func (s *TCPBus) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.Lock()
+		if s.closed {
+			s.Unlock()
+			conn.Close()
+			return
+		}
+		s.inbound[conn] = struct{}{}
+		s.wg.Add(1)
+		s.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+// deliver calls every local subscriber for specified message.
+func (s *TCPBus) deliver(msg InvalidationMessage) {
+	s.Lock()
+	list := make([]func(InvalidationMessage), 0, len(s.subscribers))
+	for _, f := range s.subscribers {
+		list = append(list, f)
+	}
+	s.Unlock()
+
+	for _, f := range list {
+		f(msg)
+	}
+}
+
+// peerList returns the current peers. Must be called with lock held.
+func (s *TCPBus) peerList() []*tcpPeer {
+	list := make([]*tcpPeer, 0, len(s.peers))
+	for _, p := range s.peers {
+		list = append(list, p)
+	}
+	return list
+}
+
+// serve reads messages sent by a peer until the connection is closed.
+func (s *TCPBus) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.Lock()
+		delete(s.inbound, conn)
+		s.Unlock()
+		conn.Close()
+	}()
+
+	dec := gob.NewDecoder(conn)
+	for {
+		var msg InvalidationMessage
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+		s.deliver(msg)
+	}
+}
+
+// Close stops sending messages to current peer and closes its connection, if
+// any.
+func (p *tcpPeer) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	close(p.done)
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.enc = nil, nil
+	}
+}
+
+// Enqueue queues specified message to be sent to current peer.
+//
+// Errors:
+// PeerQueueFullError when the queue is full; the message is dropped.
+func (p *tcpPeer) Enqueue(msg InvalidationMessage) error {
+	select {
+	case p.queue <- msg:
+		return nil
+	default:
+		return PeerQueueFullError(p.addr)
+	}
+}
+
+// run sends queued messages to current peer until it is closed. A message that
+// could not be sent is retried, waiting longer after every failure.
+func (p *tcpPeer) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	delay := TCPBUS_RETRY_MIN
+	for {
+		var msg InvalidationMessage
+		select {
+		case msg = <-p.queue:
+		case <-p.done:
+			return
+		}
+
+		for p.send(msg) != nil {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-p.done:
+				timer.Stop()
+				return
+			}
+			if delay *= 2; delay > TCPBUS_RETRY_MAX {
+				delay = TCPBUS_RETRY_MAX
+			}
+		}
+		delay = TCPBUS_RETRY_MIN
+	}
+}
+
+// send sends specified message to current peer, connecting to it when needed.
+// A broken connection is reestablished once.
+func (p *tcpPeer) send(msg InvalidationMessage) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		select {
+		case <-p.done:
+			return net.ErrClosed
+		default:
+		}
+
+		if p.conn == nil {
+			p.conn, err = net.DialTimeout("tcp", p.addr, TCPBUS_DIAL_TIMEOUT)
+			if err != nil {
+				p.conn = nil
+				return err
+			}
+			p.enc = gob.NewEncoder(p.conn)
+		}
+
+		p.conn.SetWriteDeadline(time.Now().Add(TCPBUS_WRITE_TIMEOUT))
+		if err = p.enc.Encode(&msg); err == nil {
+			return nil
+		}
+		p.conn.Close()
+		p.conn, p.enc = nil, nil
+	}
+	return err
+}
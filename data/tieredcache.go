@@ -0,0 +1,510 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skarllot/raiqub"
+)
+
+// A TieredOption represents an optional setting applied to a TieredCache when
+// it is created.
+type TieredOption func(*tieredOptions)
+
+// tieredOptions holds the settings defined by TieredOption functions.
+type tieredOptions struct {
+	writeInterval time.Duration
+	batchSize     int
+}
+
+// WithWriteBehind defers the writes to L2 store, which are done in batches by a
+// background worker every interval or as soon as batchSize keys are changed.
+// Successive changes of same key are coalesced into a single write. The keys
+// read from L1 have their expiration postponed on L2 by the same worker, then
+// the interval should be shorter than the lifetime of L2 values. The worker is
+// stopped calling TieredCache.Close().
+//
+// By default the writes are done through L2 store before returning.
+func WithWriteBehind(interval time.Duration, batchSize int) TieredOption {
+	return func(o *tieredOptions) {
+		o.writeInterval = interval
+		o.batchSize = batchSize
+	}
+}
+
+// A TieredCache provides a two-tier key:value storage, where an in-memory L1
+// Cache is placed in front of a slower L2 Store. The values are read from L1
+// and, when missing, from L2; then L1 is populated by values found on L2.
+//
+// The changes are written through L2 before returning, or optionally written
+// behind by a background worker (see WithWriteBehind). Then L2 holds every
+// value, even those evicted from L1. The values read from L1 postpone their
+// expiration on L2 as well, then they are not lost when evicted from L1.
+type TieredCache struct {
+	l1        *Cache
+	l2        Store
+	batchSize int
+	pending   map[string]*pendingWrite
+	inflight  map[string]*pendingWrite
+	touched   map[string]struct{}
+	err       error
+	janitor   *janitor
+	kick      chan struct{}
+	stop      chan struct{}
+	stopOnce  sync.Once
+	writing   sync.Mutex
+	sync.Mutex
+}
+
+// A pendingWrite represents the changes of a key that were not written to L2
+// yet. A pending value expires as it would on L1, then it is deleted from L2
+// instead of being written.
+type pendingWrite struct {
+	deleted  bool
+	put      bool
+	value    interface{}
+	lifetime time.Duration
+	expireAt time.Time
+}
+
+// NewTieredCache creates a new instance of TieredCache that reads from l1 and
+// falls back to l2. The l1 Cache is not closed by TieredCache.
+func NewTieredCache(l1 *Cache, l2 Store, opts ...TieredOption) *TieredCache {
+	var o tieredOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &TieredCache{
+		l1: l1,
+		l2: l2,
+	}
+
+	if o.writeInterval > 0 {
+		c.batchSize = o.batchSize
+		c.pending = make(map[string]*pendingWrite)
+		c.touched = make(map[string]struct{})
+		c.kick = make(chan struct{}, 1)
+		c.stop = make(chan struct{})
+		c.janitor = startJanitor(l1.clock, o.writeInterval, func() {
+			c.writeBack()
+		})
+		go c.run()
+	}
+
+	return c
+}
+
+// Add adds a new key:value to current TieredCache instance.
+//
+// Errors:
+// DuplicatedKeyError when requested key already exists.
+func (s *TieredCache) Add(key string, value interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.pending == nil {
+		if err := s.l2.Add(key, value); err != nil {
+			return err
+		}
+		s.store(key, value)
+		return nil
+	}
+
+	if _, err := s.lookup(key); err == nil {
+		return raiqub.DuplicatedKeyError(key)
+	}
+	s.store(key, value)
+	s.put(key, value)
+	return nil
+}
+
+// Close stops the write-behind worker, if any, and writes pending changes to
+// L2. Returns the error of last failed write, if any.
+func (s *TieredCache) Close() error {
+	if s.janitor != nil {
+		s.janitor.Stop()
+		s.stopOnce.Do(func() {
+			close(s.stop)
+		})
+	}
+
+	return s.Sync()
+}
+
+// Count gets the number of values stored by L2, after writing pending changes.
+func (s *TieredCache) Count() int {
+	s.writeBack()
+	return s.l2.Count()
+}
+
+// Delete deletes the specified key:value from both tiers.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TieredCache) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.pending == nil {
+		s.l1.Delete(key)
+		return s.l2.Delete(key)
+	}
+
+	if _, err := s.lookup(key); err != nil {
+		return err
+	}
+	s.l1.Delete(key)
+	s.enqueue(key).Delete()
+	return nil
+}
+
+// Flush deletes any stored value from both tiers, discarding pending changes.
+func (s *TieredCache) Flush() {
+	s.writing.Lock()
+	defer s.writing.Unlock()
+	s.Lock()
+	defer s.Unlock()
+
+	if s.pending != nil {
+		s.pending = make(map[string]*pendingWrite)
+		s.touched = make(map[string]struct{})
+	}
+	s.l1.Flush()
+	s.l2.Flush()
+}
+
+// Get gets the value stored by specified key. When the value is missing on L1
+// it is read from L2 and stored into L1. A value read from L1 postpones its
+// expiration on L2 as well.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TieredCache) Get(key string) (interface{}, error) {
+	if v, err := s.l1.Get(key); err == nil {
+		s.touch(key)
+		return v, nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	return s.lookup(key)
+}
+
+// Set sets the value of specified key on both tiers.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TieredCache) Set(key string, value interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.pending == nil {
+		if err := s.l2.Set(key, value); err != nil {
+			s.l1.Delete(key)
+			return err
+		}
+		s.store(key, value)
+		return nil
+	}
+
+	if _, err := s.lookup(key); err != nil {
+		return err
+	}
+	s.store(key, value)
+	s.put(key, value)
+	return nil
+}
+
+// SetLifetime modifies the lifetime of specified key:value on both tiers.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TieredCache) SetLifetime(key string, d time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.pending == nil {
+		if err := s.l2.SetLifetime(key, d); err != nil {
+			s.l1.Delete(key)
+			return err
+		}
+		s.l1.SetLifetime(key, d)
+		return nil
+	}
+
+	if _, err := s.lookup(key); err != nil {
+		return err
+	}
+	s.l1.SetLifetime(key, d)
+	w := s.enqueue(key)
+	w.lifetime = d
+	s.postpone(w)
+	return nil
+}
+
+// Sync writes pending changes to L2. Returns the error of last failed write,
+// including the writes done by background worker since last call.
+func (s *TieredCache) Sync() error {
+	s.writeBack()
+
+	s.Lock()
+	defer s.Unlock()
+	err := s.err
+	s.err = nil
+	return err
+}
+
+// TTL returns the remaining time until specified key:value expires, as
+// defined by pending changes or by the first tier that stores it. Unlike Get,
+// it does not postpone the expiration.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TieredCache) TTL(key string) (time.Duration, error) {
+	if d, err := s.l1.TTL(key); err == nil {
+		return d, nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.l1.clock.Now()
+	for _, changes := range []map[string]*pendingWrite{s.pending, s.inflight} {
+		if w, ok := changes[key]; ok {
+			if w.put && !w.IsExpired(now) {
+				return w.expireAt.Sub(now), nil
+			}
+			if w.put || w.deleted {
+				return 0, raiqub.InvalidKeyError(key)
+			}
+		}
+	}
+	return s.l2.TTL(key)
+}
+
+// enqueue returns the pending changes of specified key, signaling the
+// background worker when a full batch is pending. Must be called with lock
+// held.
+func (s *TieredCache) enqueue(key string) *pendingWrite {
+	w, ok := s.pending[key]
+	if !ok {
+		w = &pendingWrite{}
+		s.pending[key] = w
+	}
+
+	if s.batchSize > 0 && len(s.pending) >= s.batchSize {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return w
+}
+
+// lookup gets the value stored by specified key from pending changes or from
+// L2, storing found value into L1. Must be called with lock held.
+//
+// Errors:
+// InvalidKeyError when requested key could not be found.
+func (s *TieredCache) lookup(key string) (interface{}, error) {
+	if v, err := s.l1.Get(key); err == nil {
+		return v, nil
+	}
+
+	now := s.l1.clock.Now()
+	for _, changes := range []map[string]*pendingWrite{s.pending, s.inflight} {
+		if w, ok := changes[key]; ok {
+			if w.put && !w.IsExpired(now) {
+				s.postpone(w)
+				s.store(key, w.value)
+				return w.value, nil
+			}
+			if w.put || w.deleted {
+				return nil, raiqub.InvalidKeyError(key)
+			}
+		}
+	}
+
+	v, err := s.l2.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, v)
+	return v, nil
+}
+
+// postpone postpones the expiration of specified pending value. Must be called
+// with lock held.
+func (s *TieredCache) postpone(w *pendingWrite) {
+	d := w.lifetime
+	if d == 0 {
+		d = s.l1.lifetime
+	}
+	w.expireAt = s.l1.clock.Now().Add(d)
+}
+
+// put enqueues specified value to be written to L2. Must be called with lock
+// held.
+func (s *TieredCache) put(key string, value interface{}) {
+	w := s.enqueue(key)
+	w.put = true
+	w.value = value
+	s.postpone(w)
+}
+
+// run runs the background worker that writes full batches to L2.
+func (s *TieredCache) run() {
+	for {
+		select {
+		case <-s.kick:
+			s.writeBack()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// store stores specified key:value into L1.
+func (s *TieredCache) store(key string, value interface{}) {
+	if err := s.l1.Set(key, value); err != nil {
+		s.l1.Add(key, value)
+	}
+}
+
+// touch postpones the expiration of specified key on L2, since it was read from
+// L1. The keys are touched in batches by the background worker when the changes
+// are written behind.
+func (s *TieredCache) touch(key string) {
+	if s.pending == nil {
+		s.l2.Get(key)
+		return
+	}
+
+	s.Lock()
+	s.touched[key] = struct{}{}
+	s.Unlock()
+}
+
+// writeBack writes pending changes to L2 and postpones the expiration of
+// touched keys. The changes remain visible to lookups until they are written,
+// and the changes that failed are retried by next call.
+func (s *TieredCache) writeBack() {
+	s.writing.Lock()
+	defer s.writing.Unlock()
+
+	s.Lock()
+	if len(s.pending) == 0 && len(s.touched) == 0 {
+		s.Unlock()
+		return
+	}
+	batch := s.pending
+	touched := s.touched
+	s.pending = make(map[string]*pendingWrite)
+	s.touched = make(map[string]struct{})
+	s.inflight = batch
+	s.Unlock()
+
+	var lastErr error
+	failed := make(map[string]*pendingWrite)
+	now := s.l1.clock.Now()
+	for key, w := range batch {
+		if err := w.writeTo(s.l2, key, now); err != nil {
+			lastErr = err
+			failed[key] = w
+		}
+	}
+	for key := range touched {
+		s.l2.Get(key)
+	}
+
+	s.Lock()
+	s.inflight = nil
+	for key, w := range failed {
+		if newer, ok := s.pending[key]; ok {
+			w.merge(newer)
+		}
+		s.pending[key] = w
+	}
+	if lastErr != nil {
+		s.err = lastErr
+	}
+	s.Unlock()
+}
+
+// Delete marks current key as deleted, discarding previous changes.
+func (w *pendingWrite) Delete() {
+	*w = pendingWrite{deleted: true}
+}
+
+// IsExpired returns whether the pending value is expired at specified time.
+func (w *pendingWrite) IsExpired(now time.Time) bool {
+	return now.After(w.expireAt)
+}
+
+// merge merges specified changes, which were done after current changes, into
+// current changes.
+func (w *pendingWrite) merge(newer *pendingWrite) {
+	if newer.deleted {
+		*w = *newer
+		return
+	}
+
+	if newer.put {
+		w.put = true
+		w.value = newer.value
+	}
+	if newer.lifetime > 0 {
+		w.lifetime = newer.lifetime
+	}
+	w.expireAt = newer.expireAt
+}
+
+// writeTo writes current changes of specified key to store, as seen at
+// specified time.
+func (w *pendingWrite) writeTo(store Store, key string, now time.Time) error {
+	if w.put && w.IsExpired(now) {
+		w.Delete()
+	}
+
+	if w.deleted {
+		err := store.Delete(key)
+		if _, ok := err.(raiqub.InvalidKeyError); ok {
+			err = nil
+		}
+		if err != nil || !w.put {
+			return err
+		}
+	}
+
+	if w.put {
+		err := store.Set(key, w.value)
+		if _, ok := err.(raiqub.InvalidKeyError); ok {
+			err = store.Add(key, w.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.lifetime > 0 {
+		return store.SetLifetime(key, w.lifetime)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package data
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTieredStore(t *testing.T) {
+	testStore(t, func(d time.Duration, clock Clock) Store {
+		return NewTieredCache(
+			NewCache(d, WithClock(clock)),
+			NewCache(d, WithClock(clock)))
+	})
+}
+
+func TestTieredStoreWriteBehind(t *testing.T) {
+	testStore(t, func(d time.Duration, clock Clock) Store {
+		return NewTieredCache(
+			NewCache(d, WithClock(clock)),
+			NewCache(d, WithClock(clock)),
+			WithWriteBehind(time.Hour, 0))
+	})
+}
+
+func TestTieredCache(t *testing.T) {
+	l1 := NewCache(time.Minute, WithCapacity(1, nil))
+	l2 := NewCache(time.Minute)
+	ts := NewTieredCache(l1, l2)
+
+	ts.Add("v1", 1)
+	ts.Add("v2", 2)
+	if _, err := l1.Get("v1"); err == nil {
+		t.Error("The value v1 should be evicted from L1")
+	}
+	if l2.Count() != 2 {
+		t.Errorf("The L2 should hold 2 values, but it has %d", l2.Count())
+	}
+
+	if v, err := ts.Get("v1"); err != nil || v != 1 {
+		t.Errorf("The value v1 should be read from L2, got %v", v)
+	}
+	if v, err := l1.Get("v1"); err != nil || v != 1 {
+		t.Errorf("The value v1 should be stored into L1, got %v", v)
+	}
+
+	if err := ts.Add("v2", 3); err == nil {
+		t.Error("The duplicated v2 could be stored")
+	}
+	if err := ts.Delete("v2"); err != nil {
+		t.Error("The value v2 could not be removed")
+	}
+	if _, err := l2.Get("v2"); err == nil {
+		t.Error("The value v2 should be removed from L2")
+	}
+}
+
+func TestTieredCacheWriteBehind(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	l1 := NewCache(time.Minute, WithClock(clock), WithCapacity(1, nil))
+	l2 := NewCache(time.Minute, WithClock(clock))
+	ts := NewTieredCache(l1, l2, WithWriteBehind(time.Second, 0))
+	defer ts.Close()
+
+	ts.Add("v1", 1)
+	ts.Add("v2", 2)
+	ts.Set("v1", 3)
+	if l2.Count() != 0 {
+		t.Errorf("The L2 should not be written yet, but it has %d values",
+			l2.Count())
+	}
+	if v, err := ts.Get("v1"); err != nil || v != 3 {
+		t.Errorf("The pending value v1 should be read, got %v", v)
+	}
+
+	clock.Advance(time.Second)
+	if l2.Count() != 2 {
+		t.Errorf("The L2 should hold 2 values, but it has %d", l2.Count())
+	}
+	if v, err := l2.Get("v1"); err != nil || v != 3 {
+		t.Errorf("The last value of v1 should be written, got %v", v)
+	}
+
+	ts.Delete("v1")
+	if _, err := ts.Get("v1"); err == nil {
+		t.Error("The pending deletion of v1 should be honored")
+	}
+	if err := ts.Sync(); err != nil {
+		t.Errorf("The pending changes could not be written: %v", err)
+	}
+	if _, err := l2.Get("v1"); err == nil {
+		t.Error("The value v1 should be removed from L2")
+	}
+}
+
+// testTieredCacheTouch tests whether a value read from L1 is kept by L2 after
+// it is evicted from L1.
+func testTieredCacheTouch(t *testing.T, opts ...TieredOption) {
+	clock := NewFakeClock(testEpoch)
+	l1 := NewCache(time.Minute, WithClock(clock), WithCapacity(1, nil))
+	l2 := NewCache(time.Minute, WithClock(clock))
+	ts := NewTieredCache(l1, l2, opts...)
+	defer ts.Close()
+
+	ts.Add("s1", 1)
+	ts.Sync()
+	for i := 0; i < 5; i++ {
+		clock.Advance(time.Second * 30)
+		if _, err := ts.Get("s1"); err != nil {
+			t.Fatalf("The value s1 should be read from L1: %v", err)
+		}
+	}
+
+	ts.Add("s2", 2)
+	if v, err := ts.Get("s1"); err != nil || v != 1 {
+		t.Errorf("The value s1 read from L1 should be kept by L2: %v", err)
+	}
+}
+
+func TestTieredCacheTouch(t *testing.T) {
+	testTieredCacheTouch(t)
+}
+
+func TestTieredCacheWriteBehindTouch(t *testing.T) {
+	testTieredCacheTouch(t, WithWriteBehind(time.Second*10, 0))
+}
+
+// A failingStore represents a store whose writes fail while fail is true. The
+// onFail function is called before a write fails.
+type failingStore struct {
+	Store
+	fail   bool
+	onFail func()
+}
+
+func (s *failingStore) Add(key string, value interface{}) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	return s.Store.Add(key, value)
+}
+
+func (s *failingStore) Set(key string, value interface{}) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	return s.Store.Set(key, value)
+}
+
+func (s *failingStore) check() error {
+	if !s.fail {
+		return nil
+	}
+	if s.onFail != nil {
+		s.onFail()
+	}
+	return errors.New("store is unavailable")
+}
+
+func TestTieredCacheWriteBehindRetry(t *testing.T) {
+	clock := NewFakeClock(testEpoch)
+	l1 := NewCache(time.Minute, WithClock(clock))
+	l2 := &failingStore{Store: NewCache(time.Minute, WithClock(clock))}
+	ts := NewTieredCache(l1, l2, WithWriteBehind(time.Hour, 0))
+	defer ts.Close()
+
+	ts.Add("v1", 1)
+	ts.Add("v2", 2)
+
+	// Changes the values while they are being written
+	l2.fail = true
+	var once sync.Once
+	l2.onFail = func() {
+		once.Do(func() {
+			ts.SetLifetime("v1", time.Minute*2)
+			ts.Set("v2", 20)
+		})
+	}
+	if err := ts.Sync(); err == nil {
+		t.Fatal("The failed writes should be reported")
+	}
+
+	l2.fail = false
+	if err := ts.Sync(); err != nil {
+		t.Fatalf("The failed writes could not be retried: %v", err)
+	}
+	if v, err := l2.Get("v1"); err != nil || v != 1 {
+		t.Errorf("The failed write of v1 should be retried, got %v", v)
+	}
+	if d, _ := l2.TTL("v1"); d != time.Minute*2 {
+		t.Errorf("The newer lifetime of v1 should be kept, got %v", d)
+	}
+	if v, err := l2.Get("v2"); err != nil || v != 20 {
+		t.Errorf("The newer value of v2 should be written, got %v", v)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skarllot/raiqub/data"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMapVerifier(t *testing.T) {
+	verifier := NewMapVerifier(map[string]string{"alice": "secret"})
+	handler := HttpBasicAuthenticator{verifier}.AuthHandler(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(user, secret string) int {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.SetBasicAuth(user, secret)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := serve("alice", "secret"); code != http.StatusOK {
+		t.Errorf("The valid credentials should be accepted, got %d", code)
+	}
+	if code := serve("alice", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("The wrong secret should be rejected, got %d", code)
+	}
+	if code := serve("bob", "secret"); code != http.StatusUnauthorized {
+		t.Errorf("The unknown user should be rejected, got %d", code)
+	}
+
+	verifier.Set("bob", "other")
+	verifier.Delete("alice")
+	if code := serve("bob", "other"); code != http.StatusOK {
+		t.Errorf("The added user should be accepted, got %d", code)
+	}
+	if code := serve("alice", "secret"); code != http.StatusUnauthorized {
+		t.Errorf("The deleted user should be rejected, got %d", code)
+	}
+}
+
+func TestHtpasswdVerifier(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword(
+		[]byte("bcrypt-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error generating bcrypt hash: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".htpasswd")
+	write := func(content string, modTime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Error writing htpasswd file: %v", err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	write("# users\n"+
+		"bcrypt:"+string(bcryptHash)+"\n"+
+		"sha:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"+
+		"apr1:$apr1$r31..G..$QRSLA7/Hn4IAL5Ls3Zy111\n",
+		testEpoch)
+	verifier, err := NewHtpasswdVerifier(path, 0)
+	if err != nil {
+		t.Fatalf("Error loading htpasswd file: %v", err)
+	}
+
+	testValues := []struct {
+		user     string
+		secret   string
+		expected bool
+	}{
+		{"bcrypt", "bcrypt-secret", true},
+		{"bcrypt", "password", false},
+		{"sha", "password", true},
+		{"sha", "Password", false},
+		{"apr1", "myPassword", true},
+		{"apr1", "password", false},
+		{"unknown", "password", false},
+	}
+	for _, v := range testValues {
+		if verifier.TryAuthentication(nil, v.user, v.secret) != v.expected {
+			t.Errorf("The authentication of '%s' using '%s' should be %v",
+				v.user, v.secret, v.expected)
+		}
+	}
+
+	write("sha:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n", testEpoch.Add(time.Hour))
+	if verifier.TryAuthentication(nil, "apr1", "myPassword") {
+		t.Error("The htpasswd file should be reloaded when it changes")
+	}
+
+	write("sha:plaintext\n", testEpoch.Add(time.Hour*2))
+	if err := verifier.Reload(); err != HtpasswdLineError(1) {
+		t.Errorf("The unsupported hash should be rejected, got %v", err)
+	}
+	if !verifier.TryAuthentication(nil, "sha", "password") {
+		t.Error("The loaded users should be kept when reload fails")
+	}
+}
+
+func TestHtpasswdVerifierUnknownUser(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), 10)
+	if err != nil {
+		t.Fatalf("Error generating bcrypt hash: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".htpasswd")
+	ioutil.WriteFile(path, []byte("alice:"+string(hash)+"\n"), 0600)
+
+	verifier, err := NewHtpasswdVerifier(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Error loading htpasswd file: %v", err)
+	}
+
+	start := time.Now()
+	if verifier.TryAuthentication(nil, "bob", "secret") {
+		t.Error("The unknown user should be rejected")
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*10 {
+		t.Errorf("The unknown user should be verified against a hash, "+
+			"but it took %v", elapsed)
+	}
+}
+
+type countingVerifier struct {
+	HttpAuthenticable
+	calls int
+}
+
+func (s *countingVerifier) TryAuthentication(
+	r *http.Request,
+	user, secret string,
+) bool {
+	s.calls++
+	return s.HttpAuthenticable.TryAuthentication(r, user, secret)
+}
+
+func TestCachedVerifier(t *testing.T) {
+	clock := data.NewFakeClock(testEpoch)
+	inner := &countingVerifier{
+		HttpAuthenticable: NewMapVerifier(map[string]string{"alice": "secret"}),
+	}
+	verifier := NewCachedVerifier(inner,
+		data.NewCache(time.Minute, data.WithClock(clock)), time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if !verifier.TryAuthentication(nil, "alice", "secret") {
+			t.Fatal("The valid credentials should be accepted")
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("The verified credentials should be cached, "+
+			"but they were verified %d times", inner.calls)
+	}
+
+	if verifier.TryAuthentication(nil, "alice", "wrong") {
+		t.Error("The wrong secret should be rejected")
+	}
+	if verifier.TryAuthentication(nil, "alice", "wrong") || inner.calls != 3 {
+		t.Error("The failed attempts should not be cached")
+	}
+
+	clock.Advance(time.Minute * 2)
+	verifier.TryAuthentication(nil, "alice", "secret")
+	if inner.calls != 4 {
+		t.Error("The expired credentials should be verified again")
+	}
+
+	verifier.Forget("alice")
+	verifier.TryAuthentication(nil, "alice", "secret")
+	if inner.calls != 5 {
+		t.Error("The forgotten credentials should be verified again")
+	}
+}
+
+func TestCachedVerifierRevoked(t *testing.T) {
+	clock := data.NewFakeClock(testEpoch)
+	inner := NewMapVerifier(map[string]string{"alice": "secret"})
+	verifier := NewCachedVerifier(inner,
+		data.NewCache(time.Minute, data.WithClock(clock)), time.Minute)
+
+	verifier.TryAuthentication(nil, "alice", "secret")
+	inner.Delete("alice")
+
+	// The revoked credentials are used often enough to never become idle
+	accepted := 0
+	for i := 0; i < 6; i++ {
+		clock.Advance(time.Second * 20)
+		if verifier.TryAuthentication(nil, "alice", "secret") {
+			accepted++
+		}
+	}
+	if accepted != 3 {
+		t.Errorf("The revoked credentials should be accepted until their "+
+			"lifetime ends, but they were accepted %d times", accepted)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"net/http"
+	"time"
+
+	"github.com/skarllot/raiqub/crypt"
+	"github.com/skarllot/raiqub/data"
+)
+
+// A CachedVerifier provides a HttpAuthenticable that caches the credentials
+// successfully verified by another HttpAuthenticable, which is useful when it
+// is slow, e.g. bcrypt hashes or remote lookups.
+//
+// The cached credentials remain valid until they expire from cache, even when
+// they are changed or revoked, then the cache lifetime should be short. They
+// expire after defined lifetime since they were verified, regardless of how
+// often they are used. Failed attempts are not cached.
+type CachedVerifier struct {
+	verifier HttpAuthenticable
+	cache    *data.Cache
+	lifetime time.Duration
+	key      []byte
+}
+
+// NewCachedVerifier creates a new instance of CachedVerifier that caches the
+// credentials verified by specified HttpAuthenticable into specified cache,
+// during specified lifetime. Only a keyed digest of secrets is stored into
+// cache.
+func NewCachedVerifier(
+	verifier HttpAuthenticable,
+	cache *data.Cache,
+	d time.Duration,
+) *CachedVerifier {
+	if verifier == nil {
+		panic("HttpAuthenticable cannot be nil")
+	}
+	if cache == nil {
+		panic("Cache cannot be nil")
+	}
+
+	salter := crypt.NewSalter(crypt.NewRandomSourceListSecure(), nil)
+	return &CachedVerifier{
+		verifier: verifier,
+		cache:    cache,
+		lifetime: d,
+		key:      salter.DefaultBToken(),
+	}
+}
+
+// Forget removes the cached credentials of specified user, then they are
+// verified again by underlying HttpAuthenticable.
+func (self *CachedVerifier) Forget(user string) {
+	self.cache.Delete(user)
+}
+
+// TryAuthentication returns whether specified credentials are cached or they
+// are verified by underlying HttpAuthenticable. The digests of secrets are
+// compared in constant time.
+func (self *CachedVerifier) TryAuthentication(
+	r *http.Request,
+	user, secret string,
+) bool {
+	digest := self.digest(secret)
+	if v, err := self.cache.Get(user); err == nil {
+		if cached, ok := v.([]byte); ok && hmac.Equal(cached, digest) {
+			return true
+		}
+	}
+
+	if !self.verifier.TryAuthentication(r, user, secret) {
+		return false
+	}
+	deadline := self.cache.Clock().Now().Add(self.lifetime)
+	err := self.cache.AddWithOptions(user, digest, data.ItemOptions{
+		Deadline: deadline,
+	})
+	if err != nil {
+		self.cache.Set(user, digest)
+		self.cache.SetDeadline(user, deadline)
+	}
+	return true
+}
+
+// digest returns the keyed digest of specified secret.
+func (self *CachedVerifier) digest(secret string) []byte {
+	mac := hmac.New(sha256.New, self.key)
+	mac.Write([]byte(secret))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skarllot/raiqub/crypt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Defines the prefix of SHA-1 password hashes into htpasswd files.
+	HTPASSWD_SHA_PREFIX = "{SHA}"
+)
+
+// A HtpasswdVerifier provides a HttpAuthenticable that verifies credentials
+// against an Apache htpasswd file, which supports bcrypt, SHA and APR1 hashes.
+// The file is reloaded when it changes.
+type HtpasswdVerifier struct {
+	path     string
+	interval time.Duration
+	users    map[string]string
+	dummy    string
+	modTime  time.Time
+	size     int64
+	checked  time.Time
+	sync.Mutex
+}
+
+// NewHtpasswdVerifier creates a new instance of HtpasswdVerifier that loads
+// the htpasswd file of specified path. The file is checked for changes at
+// most once per specified interval, when credentials are verified.
+//
+// Errors:
+// HtpasswdLineError when the file has a malformed line or unsupported hash.
+// An error when the file could not be read.
+func NewHtpasswdVerifier(
+	path string,
+	interval time.Duration,
+) (*HtpasswdVerifier, error) {
+	result := &HtpasswdVerifier{
+		path:     path,
+		interval: interval,
+	}
+	if err := result.Reload(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Reload loads the htpasswd file again, regardless of whether it changed. The
+// loaded users are kept when the file could not be loaded.
+//
+// Errors:
+// HtpasswdLineError when the file has a malformed line or unsupported hash.
+// An error when the file could not be read.
+func (self *HtpasswdVerifier) Reload() error {
+	self.Lock()
+	defer self.Unlock()
+	return self.load()
+}
+
+// TryAuthentication returns whether specified secret matches the hash defined
+// for specified user, reloading the htpasswd file when it changed. The hashes
+// are compared in constant time, and unknown users are verified against a hash
+// of the file, then they are not revealed by timing.
+func (self *HtpasswdVerifier) TryAuthentication(
+	r *http.Request,
+	user, secret string,
+) bool {
+	self.Lock()
+	if now := time.Now(); now.Sub(self.checked) >= self.interval {
+		self.checked = now
+		if info, err := os.Stat(self.path); err == nil &&
+			(!info.ModTime().Equal(self.modTime) || info.Size() != self.size) {
+			self.load()
+		}
+	}
+	hash, ok := self.users[user]
+	if !ok {
+		hash = self.dummy
+	}
+	self.Unlock()
+
+	return verifyHtpasswdHash(hash, secret) && ok
+}
+
+// load loads the htpasswd file. Must be called with lock held.
+func (self *HtpasswdVerifier) load() error {
+	file, err := os.Open(self.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	users := make(map[string]string)
+	dummy := ""
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		pair := strings.SplitN(text, ":", 2)
+		if len(pair) != 2 || pair[0] == "" ||
+			!isSupportedHtpasswdHash(pair[1]) {
+			return HtpasswdLineError(line)
+		}
+		users[pair[0]] = pair[1]
+		if dummy == "" {
+			dummy = pair[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	self.users = users
+	self.dummy = dummy
+	self.modTime = info.ModTime()
+	self.size = info.Size()
+	self.checked = time.Now()
+	return nil
+}
+
+// isSupportedHtpasswdHash returns whether specified htpasswd hash uses a
+// supported algorithm.
+func isSupportedHtpasswdHash(hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"),
+		strings.HasPrefix(hash, "$2b$"),
+		strings.HasPrefix(hash, "$2y$"):
+		_, err := bcrypt.Cost([]byte(hash))
+		return err == nil
+	case strings.HasPrefix(hash, HTPASSWD_SHA_PREFIX):
+		sum, err := base64.StdEncoding.DecodeString(
+			hash[len(HTPASSWD_SHA_PREFIX):])
+		return err == nil && len(sum) == sha1.Size
+	case strings.HasPrefix(hash, crypt.APR1_PREFIX):
+		return strings.Contains(hash[len(crypt.APR1_PREFIX):], "$")
+	}
+	return false
+}
+
+// verifyHtpasswdHash returns whether specified secret matches specified
+// htpasswd hash.
+func verifyHtpasswdHash(hash, secret string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, HTPASSWD_SHA_PREFIX):
+		sum := sha1.Sum([]byte(secret))
+		computed = HTPASSWD_SHA_PREFIX +
+			base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, crypt.APR1_PREFIX):
+		salt := hash[len(crypt.APR1_PREFIX):]
+		salt = salt[:strings.Index(salt, "$")]
+		computed = crypt.APR1(secret, salt)
+	default:
+		return bcrypt.CompareHashAndPassword(
+			[]byte(hash), []byte(secret)) == nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(computed)) == 1
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"sync"
+)
+
+// A MapVerifier provides a HttpAuthenticable that verifies credentials against
+// an in-memory map of users and their secrets.
+type MapVerifier struct {
+	users map[string]string
+	sync.RWMutex
+}
+
+// NewMapVerifier creates a new instance of MapVerifier that verifies
+// credentials against a copy of specified map of users and their secrets.
+func NewMapVerifier(users map[string]string) *MapVerifier {
+	result := &MapVerifier{
+		users: make(map[string]string, len(users)),
+	}
+	for user, secret := range users {
+		result.users[user] = secret
+	}
+	return result
+}
+
+// Delete removes specified user from current instance.
+func (self *MapVerifier) Delete(user string) {
+	self.Lock()
+	defer self.Unlock()
+	delete(self.users, user)
+}
+
+// Set defines the secret of specified user, adding it when it does not exist.
+func (self *MapVerifier) Set(user, secret string) {
+	self.Lock()
+	defer self.Unlock()
+	self.users[user] = secret
+}
+
+// TryAuthentication returns whether specified secret is the one defined for
+// specified user. The secrets are compared in constant time.
+func (self *MapVerifier) TryAuthentication(
+	r *http.Request,
+	user, secret string,
+) bool {
+	self.RLock()
+	expected, ok := self.users[user]
+	self.RUnlock()
+
+	// Compares even for unknown users, then they are not revealed by timing
+	return secretEqual(expected, secret) && ok
+}
+
+// secretEqual returns whether specified secrets are equal, comparing them in
+// constant time regardless of their length.
+func secretEqual(a, b string) bool {
+	hashA := sha256.Sum256([]byte(a))
+	hashB := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(hashA[:], hashB[:]) == 1
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/skarllot/raiqub"
+	"github.com/skarllot/raiqub/data"
+)
+
+const (
+	// Defines the prefix of metric names exported by CacheStatsHandler.
+	CACHE_METRICS_PREFIX = "raiqub_cache_"
+)
+
+// A CacheStatsHandler represents a HTTP handler that renders the usage
+// statistics of registered caches in Prometheus text exposition format.
+type CacheStatsHandler struct {
+	caches map[string]data.StatsProvider
+	sync.RWMutex
+}
+
+// NewCacheStatsHandler creates a new instance of CacheStatsHandler.
+func NewCacheStatsHandler() *CacheStatsHandler {
+	return &CacheStatsHandler{
+		caches: make(map[string]data.StatsProvider),
+	}
+}
+
+// Register registers specified cache to be rendered using defined name.
+//
+// Errors:
+// DuplicatedKeyError when requested name is already registered.
+func (s *CacheStatsHandler) Register(name string, c data.StatsProvider) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.caches[name]; ok {
+		return raiqub.DuplicatedKeyError(name)
+	}
+	s.caches[name] = c
+	return nil
+}
+
+// Unregister removes the cache registered by specified name.
+//
+// Errors:
+// InvalidKeyError when requested name is not registered.
+func (s *CacheStatsHandler) Unregister(name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.caches[name]; !ok {
+		return raiqub.InvalidKeyError(name)
+	}
+	delete(s.caches, name)
+	return nil
+}
+
+// ServeHTTP renders the statistics of every registered cache.
+func (s *CacheStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	names := make([]string, 0, len(s.caches))
+	stats := make(map[string]data.CacheStats, len(s.caches))
+	for k, v := range s.caches {
+		names = append(names, k)
+		stats[k] = v.Stats()
+	}
+	s.RUnlock()
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	writeMetric(&buf, "hits_total", "counter",
+		"Number of cache lookups that found a value.")
+	for _, n := range names {
+		writeSample(&buf, "hits_total", n, "", stats[n].Hits)
+	}
+	writeMetric(&buf, "misses_total", "counter",
+		"Number of cache lookups that did not find a value.")
+	for _, n := range names {
+		writeSample(&buf, "misses_total", n, "", stats[n].Misses)
+	}
+	writeMetric(&buf, "adds_total", "counter",
+		"Number of values added to cache.")
+	for _, n := range names {
+		writeSample(&buf, "adds_total", n, "", stats[n].Adds)
+	}
+	writeMetric(&buf, "evictions_total", "counter",
+		"Number of values removed from cache by reason.")
+	for _, n := range names {
+		for _, reason := range data.EvictReasons() {
+			writeSample(&buf, "evictions_total", n, reason.String(),
+				stats[n].Evictions[reason])
+		}
+	}
+	writeMetric(&buf, "size", "gauge",
+		"Number of values currently stored by cache.")
+	for _, n := range names {
+		writeSample(&buf, "size", n, "", stats[n].Size)
+	}
+	writeMetric(&buf, "bytes", "gauge",
+		"Total size in bytes of values currently stored by cache.")
+	for _, n := range names {
+		writeSample(&buf, "bytes", n, "", stats[n].Bytes)
+	}
+
+	HttpHeader_ContentType_Prometheus().SetWriter(w.Header())
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// writeMetric writes the HELP and TYPE lines of a metric.
+func writeMetric(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s%s %s\n", CACHE_METRICS_PREFIX, name, help)
+	fmt.Fprintf(buf, "# TYPE %s%s %s\n", CACHE_METRICS_PREFIX, name, kind)
+}
+
+// writeSample writes a metric sample labeled by cache name and, optionally, by
+// eviction reason.
+func writeSample(
+	buf *bytes.Buffer,
+	name, cache, reason string,
+	value interface{},
+) {
+	fmt.Fprintf(buf, "%s%s{cache=\"%s\"", CACHE_METRICS_PREFIX, name,
+		escapeLabel(cache))
+	if reason != "" {
+		fmt.Fprintf(buf, ",reason=\"%s\"", escapeLabel(reason))
+	}
+	fmt.Fprintf(buf, "} %d\n", value)
+}
+
+// labelEscaper escapes label values as required by Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes specified label value.
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
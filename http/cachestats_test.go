@@ -0,0 +1,67 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skarllot/raiqub/data"
+)
+
+func TestCacheStatsHandler(t *testing.T) {
+	c1 := data.NewCache(time.Minute)
+	c1.Add("v1", nil)
+	c1.Get("v1")
+	c1.Get("v2")
+	c2 := data.NewShardedCache(2, time.Minute)
+	c2.Add("v1", nil)
+	c2.Delete("v1")
+
+	handler := NewCacheStatsHandler()
+	handler.Register("users", c1)
+	handler.Register("say \"hi\"", c2)
+	if err := handler.Register("users", c2); err == nil {
+		t.Error("The duplicated cache name should not be registered")
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected HTTP status: %d", w.Code)
+	}
+	body := w.Body.String()
+	expected := []string{
+		"# TYPE raiqub_cache_hits_total counter\n",
+		"raiqub_cache_hits_total{cache=\"users\"} 1\n",
+		"raiqub_cache_misses_total{cache=\"users\"} 1\n",
+		"raiqub_cache_size{cache=\"users\"} 1\n",
+		"raiqub_cache_bytes{cache=\"users\"} 0\n",
+		"raiqub_cache_evictions_total{cache=\"say \\\"hi\\\"\"," +
+			"reason=\"deleted\"} 1\n",
+		"raiqub_cache_size{cache=\"say \\\"hi\\\"\"} 0\n",
+	}
+	for _, v := range expected {
+		if !strings.Contains(body, v) {
+			t.Errorf("The metrics should contain %q:\n%s", v, body)
+		}
+	}
+}
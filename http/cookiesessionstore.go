@@ -0,0 +1,190 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/skarllot/raiqub/crypt"
+	"github.com/skarllot/raiqub/data"
+)
+
+const (
+	// Defines the maximum size of a session token encoded by
+	// CookieSessionStore, which must fit into a cookie.
+	MAX_SESSION_COOKIE_SIZE = 4096
+)
+
+// A CookieSessionStore provides stateless sessions, which values are stored
+// into their token instead of server memory, then any server that shares the
+// keyring can read them. It is a SessionStore, then SessionMiddleware writes
+// the token into a cookie.
+//
+// The session value is encoded by gob, then the concrete types stored as
+// interface values must be registered by gob.Register. The encoded value and
+// its expiration time are encrypted and authenticated by AES-GCM (see
+// crypt.Keyring), then clients can neither read nor forge sessions. The
+// expiration time is postponed every time the value is saved or renewed, which
+// issues a new token; reading a session does not postpone its expiration.
+type CookieSessionStore struct {
+	keyring  *crypt.Keyring
+	lifetime time.Duration
+	clock    data.Clock
+}
+
+// A cookieSession represents the encrypted content of a session token.
+type cookieSession struct {
+	ExpireAt int64
+	Value    interface{}
+}
+
+// NewCookieSessionStore creates a new instance of CookieSessionStore that
+// encrypts sessions using specified keyring and defines a lifetime for
+// sessions. Only the WithClock option is supported.
+func NewCookieSessionStore(
+	d time.Duration,
+	keyring *crypt.Keyring,
+	opts ...SessionOption,
+) *CookieSessionStore {
+	return &CookieSessionStore{
+		keyring:  keyring,
+		lifetime: d,
+		clock:    newSessionOptions(opts).clock,
+	}
+}
+
+// Delete validates specified token. A stateless session cannot be revoked, then
+// its token remains valid until it expires, unless the keyring is replaced.
+//
+// Errors:
+// An error when the token is malformed, forged or expired.
+func (s *CookieSessionStore) Delete(token string) error {
+	_, err := s.Get(token)
+	return err
+}
+
+// Get decrypts specified token and returns the session value.
+//
+// Errors:
+// An error when the token is malformed, forged or expired.
+func (s *CookieSessionStore) Get(token string) (interface{}, error) {
+	session, err := s.open(token)
+	if err != nil {
+		return nil, err
+	}
+	return session.Value, nil
+}
+
+// Renew encrypts the session value of specified token again, returning a new
+// token, when less than half of session lifetime remains. Otherwise returns
+// specified token. SessionMiddleware renews the sessions it reads, then the
+// sessions of active clients do not expire.
+//
+// Errors:
+// CookieSizeError when the token would not fit into a cookie; or an error when
+// the token is malformed, forged or expired.
+func (s *CookieSessionStore) Renew(token string) (string, error) {
+	session, err := s.open(token)
+	if err != nil {
+		return "", err
+	}
+
+	remaining := time.Unix(0, session.ExpireAt).Sub(s.clock.Now())
+	if remaining >= s.lifetime/2 {
+		return token, nil
+	}
+	return s.Save("", session.Value)
+}
+
+// Rotate encrypts the session value of specified token again, returning a new
+// token. The old token remains valid until it expires.
+//
+// Errors:
+// CookieSizeError when the token would not fit into a cookie; or an error when
+// the token is malformed, forged or expired.
+func (s *CookieSessionStore) Rotate(token string) (string, error) {
+	value, err := s.Get(token)
+	if err != nil {
+		return "", err
+	}
+	return s.Save("", value)
+}
+
+// Save encrypts specified session value, returning a new token that holds it.
+// The session expiration is postponed, and specified token is ignored.
+//
+// Errors:
+// CookieSizeError when the token would not fit into a cookie; or an error when
+// the value could not be encoded.
+func (s *CookieSessionStore) Save(
+	token string,
+	value interface{},
+) (string, error) {
+	session := cookieSession{
+		ExpireAt: s.clock.Now().Add(s.lifetime).UnixNano(),
+		Value:    value,
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&session); err != nil {
+		return "", err
+	}
+	sealed, err := s.keyring.Seal(buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(sealed)
+	if len(token) > MAX_SESSION_COOKIE_SIZE {
+		return "", CookieSizeError(len(token))
+	}
+	return token, nil
+}
+
+// open decrypts specified token and returns its session.
+//
+// Errors:
+// An error when the token is malformed, forged or expired.
+func (s *CookieSessionStore) open(token string) (cookieSession, error) {
+	var session cookieSession
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return session, s.getInvalidTokenError(token)
+	}
+	plaintext, err := s.keyring.Open(sealed)
+	if err != nil {
+		return session, s.getInvalidTokenError(token)
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(plaintext)).Decode(&session)
+	if err != nil || s.clock.Now().After(time.Unix(0, session.ExpireAt)) {
+		return session, s.getInvalidTokenError(token)
+	}
+	return session, nil
+}
+
+// getInvalidTokenError gets the default error when an invalid or expired
+// session token is requested.
+func (s *CookieSessionStore) getInvalidTokenError(token string) error {
+	return errors.New(fmt.Sprintf(
+		"The requested token '%s' is invalid or is expired", token))
+}
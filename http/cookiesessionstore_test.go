@@ -0,0 +1,142 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skarllot/raiqub/crypt"
+	"github.com/skarllot/raiqub/data"
+)
+
+// A cookieUser represents a session value stored by CookieSessionStore.
+type cookieUser struct {
+	ID int
+}
+
+func TestCookieSessionStore(t *testing.T) {
+	gob.Register(cookieUser{})
+	clock := data.NewFakeClock(testEpoch)
+	keyring := crypt.NewKeyring([]byte(TOKEN_SALT))
+	ts := NewCookieSessionStore(time.Minute, keyring, WithClock(clock))
+
+	token, err := ts.Save("", cookieUser{1})
+	if err != nil {
+		t.Fatalf("The session could not be saved: %v", err)
+	}
+	v, err := ts.Get(token)
+	if u, ok := v.(cookieUser); err != nil || !ok || u.ID != 1 {
+		t.Errorf("The session value could not be read: %v (%v)", v, err)
+	}
+
+	rotated, err := ts.Rotate(token)
+	if err != nil || rotated == token {
+		t.Errorf("The session could not be rotated: %v", err)
+	}
+	if v, err := ts.Get(rotated); err != nil || v != (cookieUser{1}) {
+		t.Errorf("The rotated session should keep its value, got %v", v)
+	}
+
+	other := NewCookieSessionStore(time.Minute,
+		crypt.NewKeyring([]byte("other")), WithClock(clock))
+	if _, err := other.Get(token); err == nil {
+		t.Error("The session should not be read using other keyring")
+	}
+	keyring.Rotate([]byte("newer"))
+	if _, err := ts.Get(token); err != nil {
+		t.Error("The session should be read after key rotation")
+	}
+
+	clock.Advance(time.Minute * 2)
+	if _, err := ts.Get(token); err == nil {
+		t.Error("The expired session should not be read")
+	}
+	if err := ts.Delete(token); err == nil {
+		t.Error("The expired session should not be deleted")
+	}
+	if _, err := ts.Get(""); err == nil {
+		t.Error("An empty token should not have session")
+	}
+
+	if _, err := ts.Save("", make([]byte, 4096)); err == nil {
+		t.Error("The session larger than a cookie should not be saved")
+	}
+}
+
+func TestCookieSessionMiddleware(t *testing.T) {
+	clock := data.NewFakeClock(testEpoch)
+	ts := NewCookieSessionStore(time.Minute,
+		crypt.NewKeyring([]byte(TOKEN_SALT)), WithClock(clock))
+	handler := NewSessionMiddleware(ts).Handler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			session := SessionFromContext(r.Context())
+			if r.Method == "POST" {
+				v, _ := session.Value().(int)
+				session.Set(v + 1)
+			}
+			if session.Value() == 2 {
+				session.Destroy()
+			}
+		}))
+
+	serve := func(method string, cookie *http.Cookie) *http.Cookie {
+		r := httptest.NewRequest(method, "/", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if cookies := w.Result().Cookies(); len(cookies) > 0 {
+			return cookies[len(cookies)-1]
+		}
+		return nil
+	}
+
+	cookie := serve("POST", nil)
+	if cookie == nil {
+		t.Fatal("The session cookie was not written")
+	}
+	if v, err := ts.Get(cookie.Value); err != nil || v != 1 {
+		t.Errorf("The session cookie should hold the value, got %v", v)
+	}
+	if serve("GET", cookie) != nil {
+		t.Error("The unchanged session should not be written again")
+	}
+
+	clock.Advance(time.Second * 40)
+	renewed := serve("GET", cookie)
+	if renewed == nil || renewed.Value == cookie.Value {
+		t.Fatal("The session approaching its expiration should be renewed")
+	}
+	clock.Advance(time.Second * 40)
+	if _, err := ts.Get(cookie.Value); err == nil {
+		t.Error("The old session token should expire")
+	}
+	cookie = renewed
+	if v, err := ts.Get(cookie.Value); err != nil || v != 1 {
+		t.Errorf("The renewed session should keep its value, got %v", v)
+	}
+
+	removed := serve("POST", cookie)
+	if removed == nil || removed.MaxAge >= 0 {
+		t.Errorf("The destroyed session cookie should be removed: %v", removed)
+	}
+}
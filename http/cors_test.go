@@ -91,7 +91,7 @@ func TestPreflightHeaders(t *testing.T) {
 	}
 	header = HttpHeader_AccessControlAllowHeaders()
 	if header.GetReader(res.Header).Value == "" {
-		t.Error("The header %s was not found", header.Name)
+		t.Errorf("The header %s was not found", header.Name)
 	}
 	header = HttpHeader_AccessControlAllowMethods()
 	if !strings.Contains(header.GetReader(res.Header).Value, conf.reqmethod) {
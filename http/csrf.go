@@ -0,0 +1,226 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/skarllot/raiqub/crypt"
+)
+
+const (
+	// Defines the default name of the header that holds the anti-CSRF token.
+	DEFAULT_CSRF_HEADER = "X-CSRF-Token"
+	// Defines the default name of the form field that holds the anti-CSRF
+	// token.
+	DEFAULT_CSRF_FIELD = "csrf_token"
+	// Defines the default name of the cookie that holds the anti-CSRF token on
+	// double-submit mode.
+	DEFAULT_CSRF_COOKIE = "csrf_token"
+)
+
+// A CSRFMode represents how CSRFMiddleware keeps the anti-CSRF tokens.
+type CSRFMode int
+
+const (
+	// The anti-CSRF token is bound to the request session, which requires a
+	// SessionMiddleware before CSRFMiddleware.
+	CSRFSynchronizer CSRFMode = iota
+	// The anti-CSRF token is stored into a cookie, which must match the token
+	// submitted by client.
+	CSRFDoubleSubmit
+)
+
+// A CSRFMiddleware provides a HTTP middleware that protects against Cross-Site
+// Request Forgery. Requests using unsafe methods must submit the anti-CSRF
+// token, got by CSRFTokenFromContext, through the header defined by HeaderName
+// or the form field defined by FieldName. Otherwise they are rejected by a
+// JsonError with status 403.
+type CSRFMiddleware struct {
+	// Defines how the anti-CSRF tokens are kept.
+	Mode CSRFMode
+	// The name of the header that holds the submitted token. The header is not
+	// read when empty.
+	HeaderName string
+	// The name of the form field that holds the submitted token. The form is
+	// not read when empty.
+	FieldName string
+	// The name of the cookie that holds the anti-CSRF token on double-submit
+	// mode.
+	CookieName string
+	// The path attribute of anti-CSRF cookie.
+	Path string
+	// The domain attribute of anti-CSRF cookie.
+	Domain string
+	// Whether the anti-CSRF cookie is only sent over HTTPS.
+	Secure bool
+	// The SameSite attribute of anti-CSRF cookie.
+	SameSite http.SameSite
+	// The generator of anti-CSRF tokens on double-submit mode.
+	Salter *crypt.Salter
+}
+
+// NewCSRFMiddleware creates a new instance of CSRFMiddleware that keeps the
+// anti-CSRF tokens as defined by specified mode, using default names and a
+// secure cookie.
+func NewCSRFMiddleware(mode CSRFMode) *CSRFMiddleware {
+	return &CSRFMiddleware{
+		Mode:       mode,
+		HeaderName: DEFAULT_CSRF_HEADER,
+		FieldName:  DEFAULT_CSRF_FIELD,
+		CookieName: DEFAULT_CSRF_COOKIE,
+		Path:       "/",
+		Secure:     true,
+		SameSite:   http.SameSiteLaxMode,
+		Salter:     crypt.NewSalter(crypt.NewRandomSourceListSecure(), nil),
+	}
+}
+
+// Handler is a HTTP request middleware that validates the anti-CSRF token of
+// requests using unsafe methods. It can be used by a Chain.
+func (s *CSRFMiddleware) Handler(next http.Handler) http.Handler {
+	if s.Mode == CSRFDoubleSubmit && s.Salter == nil {
+		panic("Salter cannot be nil")
+	}
+
+	f := func(w http.ResponseWriter, r *http.Request) {
+		state := &csrfState{mode: s.Mode}
+		if s.Mode == CSRFDoubleSubmit {
+			if c, err := r.Cookie(s.CookieName); err == nil {
+				state.token = c.Value
+			}
+		}
+
+		if !isSafeMethod(r.Method) {
+			if err := s.validate(r, state.token); err != nil {
+				jerr := NewJsonErrorFromError(http.StatusForbidden, err)
+				JsonWrite(w, jerr.Status, jerr)
+				return
+			}
+		}
+
+		if s.Mode == CSRFDoubleSubmit && state.token == "" {
+			state.token = s.Salter.DefaultToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     s.CookieName,
+				Value:    state.token,
+				Path:     s.Path,
+				Domain:   s.Domain,
+				Secure:   s.Secure,
+				SameSite: s.SameSite,
+			})
+		}
+
+		ctx := context.WithValue(r.Context(), csrfContextKey{}, state)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(f)
+}
+
+// readToken reads the anti-CSRF token submitted by specified request.
+func (s *CSRFMiddleware) readToken(r *http.Request) string {
+	if s.HeaderName != "" {
+		if token := r.Header.Get(s.HeaderName); token != "" {
+			return token
+		}
+	}
+	if s.FieldName != "" {
+		return r.PostFormValue(s.FieldName)
+	}
+	return ""
+}
+
+// validate validates the anti-CSRF token submitted by specified request. The
+// cookie token is the anti-CSRF token read from cookie on double-submit mode.
+//
+// Errors:
+// CSRFError when the submitted token is missing or invalid.
+func (s *CSRFMiddleware) validate(r *http.Request, cookieToken string) error {
+	submitted := s.readToken(r)
+	if submitted == "" {
+		return CSRFError("the anti-CSRF token is missing")
+	}
+
+	if s.Mode == CSRFDoubleSubmit {
+		if cookieToken == "" || subtle.ConstantTimeCompare(
+			[]byte(cookieToken), []byte(submitted)) != 1 {
+			return CSRFError("the anti-CSRF token does not match its cookie")
+		}
+		return nil
+	}
+
+	session := SessionFromContext(r.Context())
+	if session == nil {
+		return CSRFError("there is no session loaded by SessionMiddleware")
+	}
+	sessions, ok := session.middleware.Sessions.(csrfSessionStore)
+	if !ok {
+		return CSRFError("the session store does not support anti-CSRF tokens")
+	}
+	token := session.Token()
+	if token == "" || !sessions.CheckCSRFToken(token, submitted) {
+		return CSRFError("the anti-CSRF token does not match its session")
+	}
+	return nil
+}
+
+// A csrfContextKey represents the key of anti-CSRF state into request context.
+type csrfContextKey struct{}
+
+// A csrfState represents the anti-CSRF state of a HTTP request, as loaded by
+// CSRFMiddleware.
+type csrfState struct {
+	mode  CSRFMode
+	token string
+}
+
+// CSRFTokenFromContext returns the anti-CSRF token that must be submitted by
+// the next unsafe request, e.g. into a form field rendered by current request.
+// On synchronizer mode, a new session is issued when there is no valid
+// session.
+//
+// Errors:
+// CSRFError when the context was not loaded by CSRFMiddleware, or when there
+// is no session loaded by SessionMiddleware on synchronizer mode.
+func CSRFTokenFromContext(ctx context.Context) (string, error) {
+	state, ok := ctx.Value(csrfContextKey{}).(*csrfState)
+	if !ok {
+		return "", CSRFError("there is no CSRFMiddleware in request chain")
+	}
+	if state.mode == CSRFDoubleSubmit {
+		return state.token, nil
+	}
+
+	session := SessionFromContext(ctx)
+	if session == nil {
+		return "", CSRFError("there is no session loaded by SessionMiddleware")
+	}
+	return session.CSRFToken()
+}
+
+// isSafeMethod returns whether specified HTTP method is safe, i.e. it is not
+// expected to change server state.
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
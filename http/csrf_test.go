@@ -0,0 +1,186 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skarllot/raiqub/crypt"
+	"github.com/skarllot/raiqub/data"
+)
+
+func TestCSRFSynchronizer(t *testing.T) {
+	sessions := NewSessionCache(time.Minute, TOKEN_SALT)
+	csrf := NewCSRFMiddleware(CSRFSynchronizer)
+	handler := Chain{
+		NewSessionMiddleware(sessions).Handler,
+		csrf.Handler,
+	}.Get(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := CSRFTokenFromContext(r.Context())
+		if err != nil {
+			t.Fatalf("Error getting anti-CSRF token: %v", err)
+		}
+		w.Write([]byte(token))
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatal("A session should be issued to bind the anti-CSRF token")
+	}
+	session := cookies[0]
+	token := w.Body.String()
+
+	post := func(header, field string) int {
+		form := url.Values{}
+		if field != "" {
+			form.Set(DEFAULT_CSRF_FIELD, field)
+		}
+		r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			r.Header.Set(DEFAULT_CSRF_HEADER, header)
+		}
+		r.AddCookie(session)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := post("", ""); code != http.StatusForbidden {
+		t.Errorf("A request without anti-CSRF token should be rejected, got %d",
+			code)
+	}
+	if code := post("invalid", ""); code != http.StatusForbidden {
+		t.Errorf("A request with invalid anti-CSRF token should be rejected, "+
+			"got %d", code)
+	}
+	if code := post(token, ""); code != http.StatusOK {
+		t.Errorf("The anti-CSRF token from header should be valid, got %d",
+			code)
+	}
+	if code := post("", token); code != http.StatusOK {
+		t.Errorf("The anti-CSRF token from form should be valid, got %d", code)
+	}
+
+	if _, err := sessions.Rotate(session.Value); err != nil {
+		t.Fatalf("Error rotating session: %v", err)
+	}
+	if sessions.CheckCSRFToken(session.Value, token) {
+		t.Error("The anti-CSRF token should be discarded on rotation")
+	}
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	csrf := NewCSRFMiddleware(CSRFDoubleSubmit)
+	handler := csrf.Handler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token, _ := CSRFTokenFromContext(r.Context())
+			w.Write([]byte(token))
+		}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].HttpOnly {
+		t.Fatal("A readable anti-CSRF cookie should be issued")
+	}
+	cookie := cookies[0]
+	if w.Body.String() != cookie.Value {
+		t.Error("The anti-CSRF token should match its cookie")
+	}
+
+	r = httptest.NewRequest("DELETE", "/", nil)
+	r.Header.Set(DEFAULT_CSRF_HEADER, cookie.Value)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("A request without anti-CSRF cookie should be rejected, "+
+			"got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "CSRFError") {
+		t.Errorf("The request should be rejected by a JsonError, got %q",
+			w.Body.String())
+	}
+
+	r = httptest.NewRequest("DELETE", "/", nil)
+	r.Header.Set(DEFAULT_CSRF_HEADER, cookie.Value)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("The anti-CSRF token matching its cookie should be valid, "+
+			"got %d", w.Code)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("The anti-CSRF cookie should not be issued again")
+	}
+}
+
+func TestCSRFPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := data.NewFakeClock(testEpoch)
+	store, err := data.NewFileStore(filepath.Join(dir, "sessions.log"),
+		time.Minute, data.WithClock(clock))
+	if err != nil {
+		t.Fatalf("The file store could not be created: %v", err)
+	}
+	defer store.Close()
+	ts := NewSessionCacheWithStore(store, TOKEN_SALT, WithClock(clock),
+		WithTokenGenerator(crypt.NewUUIDv4Generator()))
+	ts.csrfPrune = 3
+
+	t1 := ts.Add()
+	ts.CSRFToken(t1)
+	clock.Advance(time.Second * 50)
+	t2 := ts.Add()
+	ts.CSRFToken(t2)
+	clock.Advance(time.Second * 50)
+	ts.CSRFToken(ts.Add())
+
+	if len(ts.csrf) != 2 {
+		t.Errorf("The anti-CSRF token of expired session should be pruned, "+
+			"but there are %d tokens", len(ts.csrf))
+	}
+	if ts.csrfPrune != SESSION_CSRF_PRUNE_MIN {
+		t.Errorf("The next pruning should be deferred, got %d", ts.csrfPrune)
+	}
+
+	clock.Advance(time.Second * 20)
+	if _, err := ts.Get(t2); err == nil {
+		t.Error("Pruning should not postpone the expiration of sessions")
+	}
+	if ts.CheckCSRFToken(t2, "any") || len(ts.csrf) != 1 {
+		t.Error("The anti-CSRF token of expired session should be dropped")
+	}
+}
@@ -17,11 +17,43 @@
 /*
 Package http provides operations to help HTTP server implementation.
 
+CacheStatsHandler
+
+A CacheStatsHandler provides a HTTP handler that renders the usage statistics of
+registered caches in Prometheus text exposition format.
+
 Chain
 
 A Chain provides a function to chain HTTP handlers, also know as middlewares,
 before a specified HTTP handler. A Chain is basically a slice of middlewares.
 
+CSRFMiddleware
+
+A CSRFMiddleware provides a HTTP middleware that protects against Cross-Site
+Request Forgery, rejecting unsafe requests whose anti-CSRF token is missing or
+invalid. On synchronizer mode the token is bound to the request session, then a
+SessionMiddleware must come first; on double-submit mode the token is stored
+into a cookie. Handlers get the token calling 'CSRFTokenFromContext()'.
+
+CookieSessionStore
+
+A CookieSessionStore provides stateless sessions whose values are stored into
+an encrypted token, along with their expiration time, then they are shared by
+every server that has the same crypt.Keyring. It is a SessionStore, then it can
+replace a SessionCache behind a SessionMiddleware, which writes the token into a
+cookie. Reading a session does not postpone its expiration, then the middleware
+renews the sessions that are past half of their lifetime.
+
+HttpBasicAuthenticator
+
+A HttpBasicAuthenticator provides a HTTP middleware that enforces basic
+authentication, verifying credentials by a HttpAuthenticable. The available
+verifiers are MapVerifier, which holds users in memory, HtpasswdVerifier, which
+loads an Apache htpasswd file of bcrypt, SHA or APR1 hashes and reloads it when
+it changes, and CachedVerifier, which caches the credentials verified by another
+verifier into a data.Cache for a fixed lifetime. Secrets are compared in
+constant time.
+
 HttpHeader
 
 A HttpHeader provides functions to help handle HTTP headers, both for reading
@@ -32,10 +64,40 @@ Route
 
 A Route provides a easy way to define HTTP routes and handle it.
 
+SessionMiddleware
+
+A SessionMiddleware provides a HTTP middleware that reads the session token from
+a cookie or header and loads the session into request context, which handlers
+get calling 'SessionFromContext()'. New sessions are issued when a value is
+stored, and 'Rotate()' replaces the session token on privilege change. The
+sessions are kept by a SessionStore, like SessionCache or CookieSessionStore.
+
 SessionCache
 
 A SessionCache provides session tokens to uniquely identify an user session and
 links it to specified data. Each token expires automatically if it is not used
-after defined time.
+after defined time. The 'WithClock()' option defines the clock used to expire
+sessions, and the 'WithTokenGenerator()' option defines the format of session
+tokens (see crypt.TokenGenerator).
+
+The 'Rotate()' method moves a session to a new token, e.g. on login to prevent
+session fixation. The old token remains valid for a short grace window, then
+concurrent requests using the old token do not fail.
+
+The 'WithMaxLifetime()' option defines an absolute lifetime for sessions, in
+addition to their idle lifetime. Then 'Get()' reports an expired session by
+SessionIdleError or SessionLifetimeError, according to the limit it reached.
+
+A session can be bound to a principal, like an user ID, by 'Bind()'. Then the
+sessions of a principal are listed by 'SessionsFor()' and revoked by
+'RevokeAll()', and the 'WithMaxSessionsPerPrincipal()' option limits the number
+of sessions of each principal.
+
+The 'CSRFToken()' method binds an anti-CSRF token to a session, which is
+discarded when the session is deleted or rotated. The anti-CSRF tokens are kept
+in memory, then they are not persisted along with sessions by the store.
+
+A TypedSessionCache is a SessionCache which stores values of a defined type,
+then no type assertion is required to read session values.
 */
 package http
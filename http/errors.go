@@ -0,0 +1,85 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"fmt"
+)
+
+// A CSRFError represents an error when a request was rejected because its
+// anti-CSRF token is missing or invalid.
+type CSRFError string
+
+// Error returns string representation of current instance error.
+func (e CSRFError) Error() string {
+	return fmt.Sprintf(
+		"The request was rejected by CSRF protection: %s", string(e))
+}
+
+// A SessionIdleError represents an error when a session expired because it
+// was not used within its idle lifetime.
+type SessionIdleError string
+
+// Error returns string representation of current instance error.
+func (e SessionIdleError) Error() string {
+	return fmt.Sprintf(
+		"The session '%s' expired because it was not used recently", string(e))
+}
+
+// A SessionLifetimeError represents an error when a session expired because it
+// reached its maximum lifetime.
+type SessionLifetimeError string
+
+// Error returns string representation of current instance error.
+func (e SessionLifetimeError) Error() string {
+	return fmt.Sprintf(
+		"The session '%s' expired because it reached its maximum lifetime",
+		string(e))
+}
+
+// A SnapshotNotSupportedError represents an error when a snapshot is requested
+// from a session store that does not support it.
+type SnapshotNotSupportedError string
+
+// Error returns string representation of current instance error.
+func (e SnapshotNotSupportedError) Error() string {
+	return fmt.Sprintf(
+		"The session store '%s' does not support snapshots", string(e))
+}
+
+// A CookieSizeError represents an error when an encoded session exceeds the
+// maximum size of a cookie.
+type CookieSizeError int
+
+// Error returns string representation of current instance error.
+func (e CookieSizeError) Error() string {
+	return fmt.Sprintf(
+		"Could not store the session because its token would have %d bytes",
+		int(e))
+}
+
+// A HtpasswdLineError represents an error when a htpasswd file has a malformed
+// line or a hash whose algorithm is not supported, where its value is the
+// number of the line.
+type HtpasswdLineError int
+
+// Error returns string representation of current instance error.
+func (e HtpasswdLineError) Error() string {
+	return fmt.Sprintf(
+		"Could not load the htpasswd file because its line %d is malformed "+
+			"or uses an unsupported hash", int(e))
+}
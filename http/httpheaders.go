@@ -88,6 +88,15 @@ func HttpHeader_ContentType_Json() *HttpHeader {
 	}
 }
 
+// HttpHeader_ContentType_Prometheus creates a HTTP header to define Prometheus
+// text exposition content type.
+func HttpHeader_ContentType_Prometheus() *HttpHeader {
+	return &HttpHeader{
+		"Content-Type",
+		"text/plain; version=0.0.4; charset=utf-8",
+	}
+}
+
 // HttpHeader_Location creates a HTTP header to define location of new object.
 func HttpHeader_Location() *HttpHeader {
 	return &HttpHeader{
@@ -21,80 +21,364 @@ package http
 import (
 	"errors"
 	"fmt"
+	"github.com/skarllot/raiqub"
 	"github.com/skarllot/raiqub/crypt"
 	"github.com/skarllot/raiqub/data"
+	"io"
+	"sync"
 	"time"
 )
 
+const (
+	// Defines how long SessionCache remembers why a session expired.
+	SESSION_EXPIRY_MEMORY = time.Hour * 24
+)
+
 // A SessionCache provides a temporary token to uniquely identify an user
-// session.
-type SessionCache struct {
-	cache  *data.Cache
-	salter *crypt.Salter
-}
+// session. It is a TypedSessionCache that stores any value.
+type SessionCache = TypedSessionCache[interface{}]
 
 // NewSessionCache creates a new instance of SessionCache and defines a lifetime
 // for sessions and a initial salt for random input.
-func NewSessionCache(d time.Duration, salt string) *SessionCache {
-	return &SessionCache{
-		cache: data.NewCache(d),
-		salter: crypt.NewSalter(
-			crypt.NewRandomSourceListSecure(), []byte(salt)),
+func NewSessionCache(
+	d time.Duration,
+	salt string,
+	opts ...SessionOption,
+) *SessionCache {
+	return NewTypedSessionCache[interface{}](d, salt, opts...)
+}
+
+// NewSessionCacheWithStore creates a new instance of SessionCache that stores
+// its sessions into specified store and defines a initial salt for random
+// input. The lifetime of sessions is defined by the store.
+func NewSessionCacheWithStore(
+	store data.Store,
+	salt string,
+	opts ...SessionOption,
+) *SessionCache {
+	return NewTypedSessionCacheWithStore[interface{}](store, salt, opts...)
+}
+
+// A TypedSessionCache provides a temporary token to uniquely identify an user
+// session, where the type of session values is defined by T.
+type TypedSessionCache[T any] struct {
+	store      data.Store
+	tokens     crypt.TokenGenerator
+	clock      data.Clock
+	grace      time.Duration
+	rotated    map[string]rotatedToken
+	principals map[string][]string
+	bindings   map[string]string
+	bindPrune  int
+	maxPer     int
+	maxAge     time.Duration
+	expired    *data.TypedCache[string, error]
+	csrf       map[string]string
+	csrfSalter *crypt.Salter
+	csrfPrune  int
+	csrfLock   sync.Mutex
+	sync.Mutex
+}
+
+// A rotatedToken represents the token that replaced a rotated token, which is
+// valid until defined time.
+type rotatedToken struct {
+	token    string
+	expireAt time.Time
+}
+
+// NewTypedSessionCache creates a new instance of TypedSessionCache and defines
+// a lifetime for sessions and a initial salt for random input.
+func NewTypedSessionCache[T any](
+	d time.Duration,
+	salt string,
+	opts ...SessionOption,
+) *TypedSessionCache[T] {
+	o := newSessionOptions(opts)
+	return NewTypedSessionCacheWithStore[T](
+		data.NewCache(d, data.WithClock(o.clock)), salt, opts...)
+}
+
+// NewTypedSessionCacheWithStore creates a new instance of TypedSessionCache
+// that stores its sessions into specified store and defines a initial salt for
+// random input. The lifetime of sessions is defined by the store.
+func NewTypedSessionCacheWithStore[T any](
+	store data.Store,
+	salt string,
+	opts ...SessionOption,
+) *TypedSessionCache[T] {
+	o := newSessionOptions(opts)
+	if o.tokens == nil {
+		o.tokens = crypt.NewSalter(
+			crypt.NewRandomSourceListSecure(), []byte(salt))
+	}
+
+	c := &TypedSessionCache[T]{
+		store:      store,
+		tokens:     o.tokens,
+		clock:      o.clock,
+		grace:      o.grace,
+		rotated:    make(map[string]rotatedToken),
+		principals: make(map[string][]string),
+		bindings:   make(map[string]string),
+		bindPrune:  SESSION_BIND_PRUNE_MIN,
+		maxPer:     o.maxPer,
+		maxAge:     o.maxAge,
+		csrf:       make(map[string]string),
+		csrfSalter: crypt.NewSalter(crypt.NewRandomSourceListSecure(), nil),
+		csrfPrune:  SESSION_CSRF_PRUNE_MIN,
 	}
+
+	if notifier, ok := store.(interface {
+		OnEvicted(f data.EvictedFunc[string, interface{}])
+	}); ok {
+		c.expired = data.NewTypedCache[string, error](
+			SESSION_EXPIRY_MEMORY, data.WithClock(o.clock))
+		notifier.OnEvicted(c.evicted)
+	}
+
+	return c
 }
 
 // Count gets the number of tokens stored by current instance.
-func (s *SessionCache) Count() int {
-	return s.cache.Count()
+func (s *TypedSessionCache[T]) Count() int {
+	return s.store.Count()
 }
 
 // getInvalidTokenError gets the default error when an invalid or expired token
 // is requested.
-func (s *SessionCache) getInvalidTokenError(token string) error {
+func (s *TypedSessionCache[T]) getInvalidTokenError(token string) error {
 	return errors.New(fmt.Sprintf(
 		"The requested token '%s' is invalid or is expired", token))
 }
 
-// Get gets the value stored by specified token.
-func (s *SessionCache) Get(token string) (interface{}, error) {
-	v, err := s.cache.Get(token)
+// Get gets the value stored by specified token. A token replaced by Rotate gets
+// the value of its replacement during grace window.
+//
+// Errors:
+// SessionIdleError when the session expired because it was not used recently.
+// SessionLifetimeError when the session reached its maximum lifetime.
+// An error when the token is invalid or its expiration reason is unknown.
+func (s *TypedSessionCache[T]) Get(token string) (T, error) {
+	var zero T
+	current, v, err := s.lookup(token)
 	if err != nil {
-		return nil, s.getInvalidTokenError(token)
+		return zero, err
 	}
-	return v, err
+
+	value, ok := s.unwrap(v)
+	if !ok {
+		s.Lock()
+		defer s.Unlock()
+		return zero, s.expire(current)
+	}
+	return value, nil
 }
 
-// Add creates a new unique token and stores it into current SessionCache
-// instance.
+// Add creates a new unique token and stores it into current
+// TypedSessionCache instance.
+//
+// The token creation by default generator will take at least 200
+// microseconds, but could normally take 2.5 milliseconds. The token generation
+// function it is built with security over performance (see WithTokenGenerator).
 //
-// The token creation will take at least 200 microseconds, but could normally
-// take 2.5 milliseconds. The token generation function it is built with
-// security over performance.
-func (s *SessionCache) Add() string {
-	strSum := s.salter.DefaultToken()
+// Panics when the session cannot be stored; Save returns the error instead.
+func (s *TypedSessionCache[T]) Add() string {
+	token, err := s.add()
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
 
-	err := s.cache.Add(strSum, nil)
+// add creates a new unique token and stores it into current
+// TypedSessionCache instance, returning the errors of token generator and of
+// session store.
+func (s *TypedSessionCache[T]) add() (string, error) {
+	strSum, err := s.tokens.NewToken()
 	if err != nil {
+		return "", err
+	}
+
+	var zero T
+	v := s.wrap(zero, s.clock.Now().Add(s.maxAge))
+	err = s.store.Add(strSum, v)
+	if _, ok := err.(raiqub.DuplicatedKeyError); ok {
 		panic("Something is seriously wrong, a duplicated token was generated")
+	} else if err != nil {
+		return "", err
 	}
 
-	return strSum
+	s.limit(strSum, v)
+	return strSum, nil
 }
 
-// Delete deletes specified token from current SessionCache instance.
-func (s *SessionCache) Delete(token string) error {
-	err := s.cache.Delete(token)
+// Delete deletes specified token from current instance. A token replaced by
+// Rotate deletes its replacement during grace window.
+func (s *TypedSessionCache[T]) Delete(token string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	deleted := token
+	err := s.store.Delete(token)
+	if err != nil {
+		if current, ok := s.unsafeRotated(token); ok {
+			deleted = current
+			err = s.store.Delete(current)
+		}
+	}
 	if err != nil {
 		return s.getInvalidTokenError(token)
 	}
+
+	s.unbind(deleted)
+	s.dropCSRF(deleted)
 	return nil
 }
 
-// Set store a value to specified token.
-func (s *SessionCache) Set(token string, value interface{}) error {
-	err := s.cache.Set(token, value)
+// Rotate moves the value of specified token to a new token, which is
+// returned. The old token remains valid as an alias of new token during a
+// grace window (see WithRotationGrace), then concurrent requests do not fail.
+// The value is moved atomically, then it is not lost by a concurrent Set.
+//
+// It should be called on privilege change, e.g. on login, to prevent session
+// fixation. The anti-CSRF token of the session is discarded as well.
+func (s *TypedSessionCache[T]) Rotate(oldToken string) (string, error) {
+	newToken, err := s.tokens.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.clock.Now()
+	for k, v := range s.rotated {
+		if now.After(v.expireAt) {
+			delete(s.rotated, k)
+		}
+	}
+
+	current := oldToken
+	if r, ok := s.rotated[oldToken]; ok {
+		current = s.unsafeResolve(r.token, now)
+	}
+	v, err := s.store.Get(current)
+	if err != nil {
+		return "", s.getExpiredError(current)
+	}
+	if _, ok := s.unwrap(v); !ok {
+		return "", s.expire(current)
+	}
+
+	err = s.store.Add(newToken, v)
+	if _, ok := err.(raiqub.DuplicatedKeyError); ok {
+		panic("Something is seriously wrong, a duplicated token was generated")
+	} else if err != nil {
+		return "", err
+	}
+
+	s.limit(newToken, v)
+	s.rotated[current] = rotatedToken{newToken, now.Add(s.grace)}
+	s.store.Delete(current)
+	s.rebind(current, newToken)
+	s.dropCSRF(current)
+	return newToken, nil
+}
+
+// Save stores a value to specified token, issuing a new session when the token
+// is empty or invalid. Returns the token of the session (see SessionStore).
+func (s *TypedSessionCache[T]) Save(token string, value T) (string, error) {
+	if token != "" {
+		if err := s.Set(token, value); err == nil {
+			return token, nil
+		}
+	}
+
+	token, err := s.add()
+	if err != nil {
+		return "", err
+	}
+	if err := s.Set(token, value); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Set store a value to specified token. A token replaced by Rotate sets the
+// value of its replacement during grace window.
+func (s *TypedSessionCache[T]) Set(token string, value T) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.maxAge > 0 {
+		return s.setEntry(token, value)
+	}
+
+	err := s.store.Set(token, value)
+	if err != nil {
+		if current, ok := s.unsafeRotated(token); ok {
+			err = s.store.Set(current, value)
+		}
+	}
 	if err != nil {
 		return s.getInvalidTokenError(token)
 	}
 	return nil
 }
+
+// unsafeRotated returns the token that replaced specified rotated token, when
+// it is still within its grace window. Must be called with lock held.
+func (s *TypedSessionCache[T]) unsafeRotated(token string) (string, bool) {
+	now := s.clock.Now()
+	r, ok := s.rotated[token]
+	if !ok || now.After(r.expireAt) {
+		return "", false
+	}
+	return s.unsafeResolve(r.token, now), true
+}
+
+// unsafeResolve follows the chain of rotations from specified token, returning
+// the current token. Must be called with lock held.
+func (s *TypedSessionCache[T]) unsafeResolve(
+	token string,
+	now time.Time,
+) string {
+	for {
+		r, ok := s.rotated[token]
+		if !ok || now.After(r.expireAt) {
+			return token
+		}
+		token = r.token
+	}
+}
+
+// SaveTo writes a snapshot of all sessions to specified writer (see
+// data.Cache.SaveTo).
+//
+// Errors:
+// SnapshotNotSupportedError when the session store does not support snapshots.
+func (s *TypedSessionCache[T]) SaveTo(w io.Writer) error {
+	store, ok := s.store.(interface {
+		SaveTo(io.Writer) error
+	})
+	if !ok {
+		return SnapshotNotSupportedError(fmt.Sprintf("%T", s.store))
+	}
+	return store.SaveTo(w)
+}
+
+// LoadFrom reads a snapshot written by SaveTo and restores its sessions (see
+// data.Cache.LoadFrom).
+//
+// Errors:
+// SnapshotNotSupportedError when the session store does not support snapshots.
+func (s *TypedSessionCache[T]) LoadFrom(r io.Reader) error {
+	store, ok := s.store.(interface {
+		LoadFrom(io.Reader) error
+	})
+	if !ok {
+		return SnapshotNotSupportedError(fmt.Sprintf("%T", s.store))
+	}
+	return store.LoadFrom(r)
+}
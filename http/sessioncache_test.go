@@ -19,15 +19,27 @@
 package http
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/skarllot/raiqub/crypt"
+	"github.com/skarllot/raiqub/data"
 )
 
 const TOKEN_SALT = "CvoTVwDw685Ve0qjGn//zmHGKvoCcslYNQT4AQ9FygSk9t6NuzBHuohyO" +
 	"Hhqb/1omn6c"
 
+// testEpoch defines the initial time of fake clocks used by tests.
+var testEpoch = time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 func TestSessionLifetime(t *testing.T) {
-	ts := NewSessionCache(time.Millisecond*10, TOKEN_SALT)
+	clock := data.NewFakeClock(testEpoch)
+	ts := NewSessionCache(time.Millisecond*10, TOKEN_SALT, WithClock(clock))
 
 	t1 := ts.Add()
 	t2 := ts.Add()
@@ -39,7 +51,7 @@ func TestSessionLifetime(t *testing.T) {
 		t.Error("The session t2 was not stored")
 	}
 
-	time.Sleep(time.Millisecond * 20)
+	clock.Advance(time.Millisecond * 20)
 
 	if _, err := ts.Get(t1); err == nil {
 		t.Error("The session t1 was not expired")
@@ -79,7 +91,8 @@ func TestSessionHandling(t *testing.T) {
 		9: 4099,
 	}
 
-	ts := NewSessionCache(time.Millisecond*100, TOKEN_SALT)
+	ts := NewSessionCache(time.Millisecond*100, TOKEN_SALT,
+		WithClock(data.NewFakeClock(testEpoch)))
 	if count := ts.Count(); count != 0 {
 		t.Errorf(
 			"The session cache should be empty, but it has %d items",
@@ -149,6 +162,57 @@ func TestSessionHandling(t *testing.T) {
 	}
 }
 
+func TestTypedSession(t *testing.T) {
+	type user struct {
+		name string
+	}
+	ts := NewTypedSessionCache[*user](time.Second, TOKEN_SALT)
+
+	t1 := ts.Add()
+	if v, err := ts.Get(t1); err != nil || v != nil {
+		t.Error("The new session t1 should store a nil value")
+	}
+
+	if err := ts.Set(t1, &user{"john"}); err != nil {
+		t.Error("The session t1 could not be changed")
+	}
+	if v, err := ts.Get(t1); err != nil || v.name != "john" {
+		t.Error("The session t1 was stored incorrectly")
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sessions.log")
+
+	store, err := data.NewFileStore(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := NewTypedSessionCacheWithStore[string](store, TOKEN_SALT)
+	t1 := ts.Add()
+	ts.Set(t1, "john")
+	store.Close()
+
+	store, err = data.NewFileStore(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ts = NewTypedSessionCacheWithStore[string](store, TOKEN_SALT)
+	if v, err := ts.Get(t1); err != nil || v != "john" {
+		t.Error("The session t1 was not restored from file store")
+	}
+
+	if err := ts.SaveTo(ioutil.Discard); err == nil {
+		t.Error("The file store should not support snapshots")
+	}
+}
+
 func BenchmarkSessionCreation(b *testing.B) {
 	ts := NewSessionCache(time.Millisecond, TOKEN_SALT)
 	b.ResetTimer()
@@ -157,3 +221,285 @@ func BenchmarkSessionCreation(b *testing.B) {
 		ts.Add()
 	}
 }
+
+func TestSessionTokenGenerator(t *testing.T) {
+	g := crypt.NewSignedTokenGenerator([]byte(TOKEN_SALT), nil)
+	ts := NewSessionCache(time.Minute, "", WithTokenGenerator(g))
+
+	token := ts.Add()
+	if _, err := g.Verify(token); err != nil {
+		t.Error("The session token should be generated by defined generator")
+	}
+	if _, err := ts.Get(token); err != nil {
+		t.Error("The session was not stored")
+	}
+}
+
+func TestSessionRotate(t *testing.T) {
+	clock := data.NewFakeClock(testEpoch)
+	ts := NewSessionCache(time.Minute, TOKEN_SALT,
+		WithClock(clock), WithRotationGrace(time.Second))
+
+	t1 := ts.Add()
+	ts.Set(t1, 1)
+
+	t2, err := ts.Rotate(t1)
+	if err != nil || t2 == t1 {
+		t.Fatalf("The session t1 could not be rotated: %v", err)
+	}
+	if ts.Count() != 1 {
+		t.Errorf("The session should be moved, but there are %d sessions",
+			ts.Count())
+	}
+	if v, err := ts.Get(t2); err != nil || v != 1 {
+		t.Errorf("The rotated session should keep its value, got %v", v)
+	}
+
+	if err := ts.Set(t1, 2); err != nil {
+		t.Error("The old token should be valid during grace window")
+	}
+	if v, _ := ts.Get(t2); v != 2 {
+		t.Errorf("The old token should change the new session, got %v", v)
+	}
+
+	t3, err := ts.Rotate(t1)
+	if err != nil {
+		t.Fatalf("The old token could not be rotated again: %v", err)
+	}
+	if v, err := ts.Get(t3); err != nil || v != 2 {
+		t.Errorf("The session should be rotated again, got %v", v)
+	}
+
+	clock.Advance(time.Second * 2)
+	if _, err := ts.Get(t1); err == nil {
+		t.Error("The old token should expire after grace window")
+	}
+	if _, err := ts.Get(t2); err == nil {
+		t.Error("The old token should expire after grace window")
+	}
+	if _, err := ts.Rotate(t1); err == nil {
+		t.Error("The expired token should not be rotated")
+	}
+	if v, err := ts.Get(t3); err != nil || v != 2 {
+		t.Errorf("The current token should remain valid, got %v", v)
+	}
+}
+
+// A hookStore represents a session store that calls a function before adding
+// a value, or fails to add it.
+type hookStore struct {
+	data.Store
+	onAdd  func()
+	addErr error
+}
+
+func (s *hookStore) Add(key string, value interface{}) error {
+	if s.onAdd != nil {
+		s.onAdd()
+	}
+	if s.addErr != nil {
+		return s.addErr
+	}
+	return s.Store.Add(key, value)
+}
+
+func TestSessionSaveStoreError(t *testing.T) {
+	storeErr := errors.New("store is unavailable")
+	store := &hookStore{Store: data.NewCache(time.Minute), addErr: storeErr}
+	ts := NewSessionCacheWithStore(store, TOKEN_SALT)
+
+	token, err := ts.Save("", 1)
+	if err != storeErr {
+		t.Errorf("The error of store should be returned: %v", err)
+	}
+	if token != "" {
+		t.Errorf("No token should be returned on error: %s", token)
+	}
+}
+
+func TestSessionRotateConcurrentSet(t *testing.T) {
+	store := &hookStore{Store: data.NewCache(time.Minute)}
+	ts := NewSessionCacheWithStore(store, TOKEN_SALT)
+	t1 := ts.Add()
+	ts.Set(t1, 1)
+
+	// Changes the session while it is being moved to new token
+	var wg sync.WaitGroup
+	var setErr error
+	store.onAdd = func() {
+		store.onAdd = nil
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			setErr = ts.Set(t1, 2)
+		}()
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t2, err := ts.Rotate(t1)
+	if err != nil {
+		t.Fatalf("The session t1 could not be rotated: %v", err)
+	}
+	wg.Wait()
+
+	if setErr != nil {
+		t.Fatalf("The old token should be valid during grace window: %v",
+			setErr)
+	}
+	if v, err := ts.Get(t2); err != nil || v != 2 {
+		t.Errorf("The value set during rotation should be kept, got %v", v)
+	}
+}
+
+func TestSessionPrincipal(t *testing.T) {
+	clock := data.NewFakeClock(testEpoch)
+	ts := NewSessionCache(time.Minute, TOKEN_SALT,
+		WithClock(clock), WithMaxSessionsPerPrincipal(2))
+
+	t1, t2, t3, t4 := ts.Add(), ts.Add(), ts.Add(), ts.Add()
+	ts.Bind(t1, "alice")
+	ts.Bind(t2, "alice")
+	ts.Bind(t4, "bob")
+	if err := ts.Bind("t5", "bob"); err == nil {
+		t.Error("An invalid session should not be bound")
+	}
+
+	if tokens := ts.SessionsFor("alice"); len(tokens) != 2 ||
+		tokens[0] != t1 || tokens[1] != t2 {
+		t.Errorf("The sessions of alice should be [t1 t2], got %v", tokens)
+	}
+
+	ts.Bind(t3, "alice")
+	if _, err := ts.Get(t1); err == nil {
+		t.Error("The oldest session of alice should be deleted")
+	}
+	if tokens := ts.SessionsFor("alice"); len(tokens) != 2 ||
+		tokens[0] != t2 || tokens[1] != t3 {
+		t.Errorf("The sessions of alice should be [t2 t3], got %v", tokens)
+	}
+
+	t5, _ := ts.Rotate(t2)
+	if tokens := ts.SessionsFor("alice"); len(tokens) != 2 || tokens[0] != t5 {
+		t.Errorf("The rotated session should keep its binding, got %v", tokens)
+	}
+
+	ts.Delete(t3)
+	if tokens := ts.SessionsFor("alice"); len(tokens) != 1 {
+		t.Errorf("The deleted session should be unbound, got %v", tokens)
+	}
+
+	if n := ts.RevokeAll("alice"); n != 1 {
+		t.Errorf("One session of alice should be revoked, got %d", n)
+	}
+	if _, err := ts.Get(t5); err == nil {
+		t.Error("The revoked session should be deleted")
+	}
+	if _, err := ts.Get(t4); err != nil {
+		t.Error("The session of bob should not be revoked")
+	}
+
+	clock.Advance(time.Minute * 2)
+	if tokens := ts.SessionsFor("bob"); len(tokens) != 0 {
+		t.Errorf("The expired sessions should not be listed, got %v", tokens)
+	}
+}
+
+func TestSessionPrincipalIdle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raiqub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := data.NewFakeClock(testEpoch)
+	store, err := data.NewFileStore(filepath.Join(dir, "sessions.log"),
+		time.Minute, data.WithClock(clock))
+	if err != nil {
+		t.Fatalf("The file store could not be created: %v", err)
+	}
+	defer store.Close()
+	ts := NewSessionCacheWithStore(store, TOKEN_SALT, WithClock(clock))
+
+	t1 := ts.Add()
+	ts.Bind(t1, "alice")
+	for i := 0; i < 5; i++ {
+		clock.Advance(time.Second * 50)
+		ts.SessionsFor("alice")
+	}
+	if _, err := ts.Get(t1); err == nil {
+		t.Error("Listing the sessions of a principal should not keep them alive")
+	}
+}
+
+func TestSessionPrincipalPrune(t *testing.T) {
+	clock := data.NewFakeClock(testEpoch)
+	ts := NewSessionCache(time.Minute, TOKEN_SALT, WithClock(clock),
+		WithTokenGenerator(crypt.NewUUIDv4Generator()))
+	ts.bindPrune = 3
+
+	t1 := ts.Add()
+	ts.Bind(t1, "alice")
+	clock.Advance(time.Second * 50)
+	t2 := ts.Add()
+	ts.Bind(t2, "bob")
+	clock.Advance(time.Second * 50)
+	ts.Bind(ts.Add(), "carol")
+
+	if len(ts.bindings) != 2 || len(ts.principals) != 2 {
+		t.Errorf("The binding of expired session should be pruned, "+
+			"but there are %d bindings", len(ts.bindings))
+	}
+	if ts.bindPrune != SESSION_BIND_PRUNE_MIN {
+		t.Errorf("The next pruning should be deferred, got %d", ts.bindPrune)
+	}
+
+	clock.Advance(time.Second * 20)
+	if _, err := ts.Get(t2); err == nil {
+		t.Error("Pruning should not postpone the expiration of sessions")
+	}
+}
+
+func TestSessionMaxLifetime(t *testing.T) {
+	clock := data.NewFakeClock(testEpoch)
+	ts := NewSessionCache(time.Minute, TOKEN_SALT,
+		WithClock(clock), WithMaxLifetime(time.Minute*3))
+
+	t1 := ts.Add()
+	t2 := ts.Add()
+	ts.Set(t1, 1)
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second * 50)
+		if _, err := ts.Get(t1); err != nil {
+			t.Fatalf("The session t1 should be postponed: %v", err)
+		}
+	}
+
+	if _, err := ts.Get(t2); err != SessionIdleError(t2) {
+		t.Errorf("The session t2 should expire by inactivity, got %v", err)
+	}
+
+	t3, err := ts.Rotate(t1)
+	if err != nil {
+		t.Fatalf("The session t1 could not be rotated: %v", err)
+	}
+	clock.Advance(time.Second * 30)
+	if v, err := ts.Get(t3); err != SessionLifetimeError(t3) {
+		t.Errorf("The rotated session should keep its maximum lifetime, "+
+			"got %v (%v)", v, err)
+	}
+	if err := ts.Set(t3, 2); err != SessionLifetimeError(t3) {
+		t.Errorf("The expired session t3 should not be changeable, got %v",
+			err)
+	}
+	if _, err := ts.Get("t4"); err == nil {
+		t.Error("The invalid session t4 should not be found")
+	}
+	// The session expired by inactivity long before its maximum lifetime
+	ts = NewSessionCache(time.Minute, TOKEN_SALT,
+		WithClock(clock), WithMaxLifetime(time.Hour))
+	t5 := ts.Add()
+	clock.Advance(time.Hour * 2)
+	if _, err := ts.Get(t5); err != SessionIdleError(t5) {
+		t.Errorf("The session t5 should expire by inactivity, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"crypto/subtle"
+)
+
+const (
+	// Defines the minimum number of anti-CSRF tokens that triggers the removal
+	// of tokens bound to expired sessions.
+	SESSION_CSRF_PRUNE_MIN = 1024
+)
+
+// CSRFToken returns the anti-CSRF token bound to the session of specified
+// token, generating it when the session has none. The anti-CSRF token is
+// discarded when the session is deleted or rotated (see CSRFMiddleware).
+//
+// The anti-CSRF tokens are kept by current instance instead of the session
+// store, then they are not persisted along with sessions and a new token is
+// generated after a restart.
+//
+// Errors:
+// SessionIdleError when the session expired because it was not used recently.
+// SessionLifetimeError when the session reached its maximum lifetime.
+// An error when the token is invalid or its expiration reason is unknown.
+func (s *TypedSessionCache[T]) CSRFToken(token string) (string, error) {
+	current, _, err := s.lookup(token)
+	if err != nil {
+		return "", err
+	}
+
+	s.csrfLock.Lock()
+	if csrf, ok := s.csrf[current]; ok {
+		s.csrfLock.Unlock()
+		return csrf, nil
+	}
+	csrf := s.csrfSalter.DefaultToken()
+	s.csrf[current] = csrf
+	prune := s.expired == nil && len(s.csrf) >= s.csrfPrune
+	s.csrfLock.Unlock()
+
+	if prune {
+		s.pruneCSRF()
+	}
+	return csrf, nil
+}
+
+// CheckCSRFToken returns whether specified anti-CSRF token is the one bound to
+// the session of specified token. The tokens are compared in constant time.
+func (s *TypedSessionCache[T]) CheckCSRFToken(token, csrf string) bool {
+	current, _, err := s.lookup(token)
+	if err != nil {
+		s.dropCSRF(token)
+		return false
+	}
+	if csrf == "" {
+		return false
+	}
+
+	s.csrfLock.Lock()
+	expected, ok := s.csrf[current]
+	s.csrfLock.Unlock()
+
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(expected), []byte(csrf)) == 1
+}
+
+// dropCSRF discards the anti-CSRF token bound to the session of specified
+// token, if any.
+func (s *TypedSessionCache[T]) dropCSRF(token string) {
+	s.csrfLock.Lock()
+	delete(s.csrf, token)
+	s.csrfLock.Unlock()
+}
+
+// pruneCSRF discards the anti-CSRF tokens bound to expired sessions, which are
+// not notified by stores that do not support eviction callbacks. The sessions
+// are checked without postponing their expiration, and the next pruning is
+// deferred until the number of tokens doubles.
+func (s *TypedSessionCache[T]) pruneCSRF() {
+	s.csrfLock.Lock()
+	tokens := make([]string, 0, len(s.csrf))
+	for k := range s.csrf {
+		tokens = append(tokens, k)
+	}
+	s.csrfLock.Unlock()
+
+	for _, token := range tokens {
+		if !s.exists(token) {
+			s.dropCSRF(token)
+		}
+	}
+
+	s.csrfLock.Lock()
+	s.csrfPrune = 2 * len(s.csrf)
+	if s.csrfPrune < SESSION_CSRF_PRUNE_MIN {
+		s.csrfPrune = SESSION_CSRF_PRUNE_MIN
+	}
+	s.csrfLock.Unlock()
+}
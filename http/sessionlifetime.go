@@ -0,0 +1,185 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"encoding/gob"
+	"time"
+
+	"github.com/skarllot/raiqub/data"
+)
+
+func init() {
+	gob.Register(sessionEntry{})
+}
+
+// A sessionEntry represents a stored session that has a maximum lifetime.
+type sessionEntry struct {
+	Value    interface{}
+	Deadline time.Time
+}
+
+// evicted discards the anti-CSRF tokens of the sessions removed by store and
+// remembers why they expired. The sessions reach their maximum lifetime on
+// stores that support deadlines (see limit), otherwise they are reported as
+// expired by inactivity.
+func (s *TypedSessionCache[T]) evicted(
+	token string,
+	value interface{},
+	reason data.EvictReason,
+) {
+	s.dropCSRF(token)
+	switch reason {
+	case data.EvictExpired:
+		s.remember(token, SessionIdleError(token))
+	case data.EvictDeadline:
+		s.remember(token, SessionLifetimeError(token))
+	}
+}
+
+// expire deletes the session of specified token, which reached its maximum
+// lifetime, and returns the error that reports it. Must be called with lock
+// held.
+func (s *TypedSessionCache[T]) expire(token string) error {
+	err := SessionLifetimeError(token)
+	s.store.Delete(token)
+	s.unbind(token)
+	s.dropCSRF(token)
+	s.remember(token, err)
+	return err
+}
+
+// getExpiredError gets the error that reports why the session of specified
+// token expired, or the default error when the reason is unknown.
+func (s *TypedSessionCache[T]) getExpiredError(token string) error {
+	if s.expired != nil {
+		if err, e := s.expired.Get(token); e == nil {
+			return err
+		}
+	}
+	return s.getInvalidTokenError(token)
+}
+
+// limit defines the maximum lifetime of specified stored session as its
+// deadline on session store, when supported, then the store expires the session
+// at its deadline.
+func (s *TypedSessionCache[T]) limit(token string, v interface{}) {
+	e, ok := v.(sessionEntry)
+	if !ok {
+		return
+	}
+	if store, ok := s.store.(interface {
+		SetDeadline(key string, t time.Time) error
+	}); ok {
+		store.SetDeadline(token, e.Deadline)
+	}
+}
+
+// lookup gets the stored value of specified token, or of its replacement when
+// it was rotated. Returns the token of stored value.
+//
+// Errors:
+// SessionIdleError when the session expired because it was not used recently.
+// SessionLifetimeError when the session reached its maximum lifetime.
+// An error when the token is invalid or its expiration reason is unknown.
+func (s *TypedSessionCache[T]) lookup(
+	token string,
+) (string, interface{}, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.unsafeLookup(token)
+}
+
+// unsafeLookup gets the stored value of specified token, or of its replacement
+// when it was rotated. Returns the token of stored value. Must be called with
+// lock held.
+//
+// Errors:
+// SessionIdleError when the session expired because it was not used recently.
+// SessionLifetimeError when the session reached its maximum lifetime.
+// An error when the token is invalid or its expiration reason is unknown.
+func (s *TypedSessionCache[T]) unsafeLookup(
+	token string,
+) (string, interface{}, error) {
+	v, err := s.store.Get(token)
+	if err == nil {
+		return token, v, nil
+	}
+
+	if current, ok := s.unsafeRotated(token); ok {
+		if v, err = s.store.Get(current); err == nil {
+			return current, v, nil
+		}
+		return "", nil, s.getExpiredError(current)
+	}
+	return "", nil, s.getExpiredError(token)
+}
+
+// remember remembers the error that reports why the session of specified token
+// expired.
+func (s *TypedSessionCache[T]) remember(token string, err error) {
+	if s.expired == nil {
+		return
+	}
+	if s.expired.Add(token, err) != nil {
+		s.expired.Set(token, err)
+	}
+}
+
+// setEntry stores a value to specified token, keeping the maximum lifetime of
+// its session. Must be called with lock held.
+func (s *TypedSessionCache[T]) setEntry(token string, value T) error {
+	current, v, err := s.unsafeLookup(token)
+	if err != nil {
+		return err
+	}
+
+	deadline := s.clock.Now().Add(s.maxAge)
+	if e, ok := v.(sessionEntry); ok {
+		deadline = e.Deadline
+	}
+	if !s.clock.Now().Before(deadline) {
+		return s.expire(current)
+	}
+
+	if err := s.store.Set(current, s.wrap(value, deadline)); err != nil {
+		return s.getInvalidTokenError(token)
+	}
+	return nil
+}
+
+// unwrap returns the session value of specified stored value and whether the
+// session is within its maximum lifetime.
+func (s *TypedSessionCache[T]) unwrap(v interface{}) (T, bool) {
+	e, ok := v.(sessionEntry)
+	if !ok {
+		value, _ := v.(T)
+		return value, true
+	}
+
+	value, _ := e.Value.(T)
+	return value, s.clock.Now().Before(e.Deadline)
+}
+
+// wrap returns the value to store for a session which expires at specified
+// deadline, when a maximum lifetime is defined.
+func (s *TypedSessionCache[T]) wrap(value T, deadline time.Time) interface{} {
+	if s.maxAge <= 0 {
+		return value
+	}
+	return sessionEntry{value, deadline}
+}
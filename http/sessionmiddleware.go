@@ -0,0 +1,279 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+const (
+	// Defines the default name of the cookie that holds the session token.
+	DEFAULT_SESSION_COOKIE = "session"
+)
+
+// A SessionMiddleware provides a HTTP middleware that loads the session
+// identified by request token into request context (see SessionFromContext).
+//
+// The token is read from the header defined by HeaderName, when defined, or
+// from the cookie defined by CookieName. New sessions are issued on demand,
+// when a value is stored into a request without valid session. The sessions of
+// stores that do not postpone their expiration when read, like
+// CookieSessionStore, are renewed as they approach their expiration.
+type SessionMiddleware struct {
+	// The store of sessions, e.g. a SessionCache or a CookieSessionStore.
+	Sessions SessionStore
+	// The name of the cookie that holds the session token. The cookie is not
+	// used when empty.
+	CookieName string
+	// The name of the header that holds the session token. The header is not
+	// used when empty.
+	HeaderName string
+	// The path attribute of session cookie.
+	Path string
+	// The domain attribute of session cookie.
+	Domain string
+	// Whether the session cookie is only sent over HTTPS.
+	Secure bool
+	// Whether the session cookie is hidden from scripts.
+	HttpOnly bool
+	// The SameSite attribute of session cookie.
+	SameSite http.SameSite
+}
+
+// NewSessionMiddleware creates a new instance of SessionMiddleware that stores
+// sessions into specified SessionStore, using a secure cookie with default
+// name.
+func NewSessionMiddleware(sessions SessionStore) *SessionMiddleware {
+	return &SessionMiddleware{
+		Sessions:   sessions,
+		CookieName: DEFAULT_SESSION_COOKIE,
+		Path:       "/",
+		Secure:     true,
+		HttpOnly:   true,
+		SameSite:   http.SameSiteLaxMode,
+	}
+}
+
+// Handler is a HTTP request middleware that loads the request session into
+// request context. It can be used by a Chain.
+func (s *SessionMiddleware) Handler(next http.Handler) http.Handler {
+	if s.Sessions == nil {
+		panic("SessionStore cannot be nil")
+	}
+
+	f := func(w http.ResponseWriter, r *http.Request) {
+		session := &Session{
+			middleware: s,
+			writer:     w,
+		}
+		if token := s.readToken(r); token != "" {
+			if v, err := s.Sessions.Get(token); err == nil {
+				session.token = s.renew(w, token)
+				session.value = v
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), sessionContextKey{}, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(f)
+}
+
+// readToken reads the session token from specified request.
+func (s *SessionMiddleware) readToken(r *http.Request) string {
+	if s.HeaderName != "" {
+		if token := r.Header.Get(s.HeaderName); token != "" {
+			return token
+		}
+	}
+	if s.CookieName != "" {
+		if c, err := r.Cookie(s.CookieName); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// renew renews the session of specified token, when supported by SessionStore,
+// and writes the new token to response. Returns the current token of session.
+func (s *SessionMiddleware) renew(w http.ResponseWriter, token string) string {
+	sessions, ok := s.Sessions.(renewableSessionStore)
+	if !ok {
+		return token
+	}
+
+	renewed, err := sessions.Renew(token)
+	if err != nil || renewed == token {
+		return token
+	}
+	s.writeToken(w, renewed)
+	return renewed
+}
+
+// writeToken writes specified session token to response. An empty token
+// removes the session cookie from client.
+func (s *SessionMiddleware) writeToken(w http.ResponseWriter, token string) {
+	if s.HeaderName != "" {
+		w.Header().Set(s.HeaderName, token)
+	}
+	if s.CookieName != "" {
+		c := &http.Cookie{
+			Name:     s.CookieName,
+			Value:    token,
+			Path:     s.Path,
+			Domain:   s.Domain,
+			Secure:   s.Secure,
+			HttpOnly: s.HttpOnly,
+			SameSite: s.SameSite,
+		}
+		if token == "" {
+			c.MaxAge = -1
+		}
+		http.SetCookie(w, c)
+	}
+}
+
+// A sessionContextKey represents the key of Session into request context.
+type sessionContextKey struct{}
+
+// A Session represents the session of a HTTP request, as loaded by
+// SessionMiddleware. The methods that change the session token write it to
+// response, then they must be called before writing response body.
+type Session struct {
+	middleware *SessionMiddleware
+	writer     http.ResponseWriter
+	token      string
+	value      interface{}
+	sync.Mutex
+}
+
+// SessionFromContext returns the Session loaded by SessionMiddleware into
+// specified context, or nil when there is no such session.
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return session
+}
+
+// CSRFToken returns the anti-CSRF token bound to current session, issuing a new
+// session when there is no valid session (see CSRFMiddleware).
+//
+// Errors:
+// CSRFError when the SessionStore does not bind anti-CSRF tokens to sessions.
+func (s *Session) CSRFToken() (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	sessions, ok := s.middleware.Sessions.(csrfSessionStore)
+	if !ok {
+		return "", CSRFError("the session store does not support anti-CSRF tokens")
+	}
+	if s.token != "" {
+		if csrf, err := sessions.CSRFToken(s.token); err == nil {
+			return csrf, nil
+		}
+	}
+
+	if err := s.save(s.value); err != nil {
+		return "", err
+	}
+	return sessions.CSRFToken(s.token)
+}
+
+// Destroy deletes current session and removes its token from client.
+func (s *Session) Destroy() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.token == "" {
+		return
+	}
+	s.middleware.Sessions.Delete(s.token)
+	s.middleware.writeToken(s.writer, "")
+	s.token = ""
+	s.value = nil
+}
+
+// IsNew returns whether current request has no valid session.
+func (s *Session) IsNew() bool {
+	return s.Token() == ""
+}
+
+// Rotate replaces the token of current session by a new one, keeping its value.
+// It should be called on privilege change, e.g. on login, to prevent session
+// fixation. A new session is issued when there is no valid session.
+func (s *Session) Rotate() error {
+	s.Lock()
+	defer s.Unlock()
+
+	sessions := s.middleware.Sessions
+	token := ""
+	if s.token != "" {
+		token, _ = sessions.Rotate(s.token)
+	}
+	if token == "" {
+		s.token = ""
+		return s.save(s.value)
+	}
+
+	s.token = token
+	s.middleware.writeToken(s.writer, token)
+	return nil
+}
+
+// Set stores specified value into current session, issuing a new session when
+// there is no valid session.
+func (s *Session) Set(value interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.save(value)
+}
+
+// Token returns the token of current session, or an empty string when there is
+// no valid session.
+func (s *Session) Token() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.token
+}
+
+// Value returns the value stored into current session.
+func (s *Session) Value() interface{} {
+	s.Lock()
+	defer s.Unlock()
+	return s.value
+}
+
+// save stores specified value into current session, issuing a new session when
+// there is no valid session, and writes the session token to response when it
+// changes. Must be called with lock held.
+func (s *Session) save(value interface{}) error {
+	token, err := s.middleware.Sessions.Save(s.token, value)
+	if err != nil {
+		return err
+	}
+
+	s.value = value
+	if token != s.token {
+		s.token = token
+		s.middleware.writeToken(s.writer, token)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionMiddleware(t *testing.T) {
+	sessions := NewSessionCache(time.Minute, TOKEN_SALT)
+	m := NewSessionMiddleware(sessions)
+	handler := Chain{m.Handler}.Get(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			session := SessionFromContext(r.Context())
+			switch r.URL.Path {
+			case "/login":
+				session.Set("user")
+				session.Rotate()
+			case "/logout":
+				session.Destroy()
+			}
+			if v, ok := session.Value().(string); ok {
+				w.Write([]byte(v))
+			}
+		}))
+
+	serve := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	lastCookie := func(w *httptest.ResponseRecorder) *http.Cookie {
+		cookies := w.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Fatal("The session cookie was not written")
+		}
+		return cookies[len(cookies)-1]
+	}
+
+	if w := serve("/", nil); len(w.Result().Cookies()) != 0 {
+		t.Error("A session should not be issued without storing a value")
+	}
+
+	cookie := lastCookie(serve("/login", nil))
+	if !cookie.Secure || !cookie.HttpOnly ||
+		cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("The session cookie flags are not defined: %v", cookie)
+	}
+	if sessions.Count() != 1 {
+		t.Errorf("The rotated session should replace the issued one, "+
+			"but there are %d sessions", sessions.Count())
+	}
+	if w := serve("/", cookie); w.Body.String() != "user" {
+		t.Errorf("The session value should be loaded, got %q", w.Body.String())
+	}
+
+	removed := lastCookie(serve("/logout", cookie))
+	if removed.MaxAge >= 0 || removed.Value != "" {
+		t.Errorf("The session cookie should be removed: %v", removed)
+	}
+	if w := serve("/", cookie); w.Body.String() != "" {
+		t.Error("The destroyed session should not be loaded")
+	}
+}
+
+func TestSessionMiddlewareHeader(t *testing.T) {
+	sessions := NewSessionCache(time.Minute, TOKEN_SALT)
+	token := sessions.Add()
+	sessions.Set(token, 1)
+
+	m := NewSessionMiddleware(sessions)
+	m.CookieName = ""
+	m.HeaderName = "X-Session-Token"
+	handler := m.Handler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			session := SessionFromContext(r.Context())
+			if session.IsNew() || session.Value() != 1 {
+				t.Error("The session should be loaded from header")
+			}
+			session.Rotate()
+		}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Session-Token", token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	rotated := w.Header().Get("X-Session-Token")
+	if rotated == "" || rotated == token {
+		t.Error("The rotated token should be written to header")
+	}
+	if v, err := sessions.Get(rotated); err != nil || v != 1 {
+		t.Errorf("The rotated session should keep its value, got %v", v)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("The session cookie should not be written")
+	}
+}
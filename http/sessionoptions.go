@@ -0,0 +1,100 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+import (
+	"time"
+
+	"github.com/skarllot/raiqub/crypt"
+	"github.com/skarllot/raiqub/data"
+)
+
+const (
+	// Defines the default duration that a rotated session token remains
+	// valid.
+	DEFAULT_SESSION_ROTATION_GRACE = time.Second * 10
+)
+
+// A SessionOption defines an optional setting for SessionCache.
+type SessionOption func(*sessionOptions)
+
+// A sessionOptions represents the optional settings of a SessionCache.
+type sessionOptions struct {
+	clock  data.Clock
+	tokens crypt.TokenGenerator
+	grace  time.Duration
+	maxPer int
+	maxAge time.Duration
+}
+
+// WithClock defines the Clock used to expire sessions and rotated tokens. The
+// system clock is used by default. The sessions stored into a custom store are
+// expired by the store itself.
+func WithClock(c data.Clock) SessionOption {
+	return func(o *sessionOptions) {
+		o.clock = c
+	}
+}
+
+// WithTokenGenerator defines the generator of session tokens, e.g. to match
+// the token format expected by other systems. By default the tokens are
+// generated by a crypt.Salter initialized by the salt passed to SessionCache
+// constructor, which is ignored when this option is defined.
+func WithTokenGenerator(g crypt.TokenGenerator) SessionOption {
+	return func(o *sessionOptions) {
+		o.tokens = g
+	}
+}
+
+// WithRotationGrace defines the duration that a token replaced by Rotate
+// remains valid, then concurrent requests using the old token do not fail. The
+// DEFAULT_SESSION_ROTATION_GRACE is used by default.
+func WithRotationGrace(d time.Duration) SessionOption {
+	return func(o *sessionOptions) {
+		o.grace = d
+	}
+}
+
+// WithMaxLifetime defines an absolute lifetime for sessions, counted from their
+// creation, regardless of how they are used. The idle lifetime of sessions is
+// still enforced.
+func WithMaxLifetime(d time.Duration) SessionOption {
+	return func(o *sessionOptions) {
+		o.maxAge = d
+	}
+}
+
+// WithMaxSessionsPerPrincipal limits the number of sessions bound to a same
+// principal (see Bind). When a new session would exceed max sessions, the
+// oldest session of the principal is deleted.
+func WithMaxSessionsPerPrincipal(max int) SessionOption {
+	return func(o *sessionOptions) {
+		o.maxPer = max
+	}
+}
+
+// newSessionOptions applies specified options over default settings.
+func newSessionOptions(opts []SessionOption) sessionOptions {
+	o := sessionOptions{
+		clock: data.NewSystemClock(),
+		grace: DEFAULT_SESSION_ROTATION_GRACE,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+const (
+	// Defines the minimum number of bound sessions that triggers the removal of
+	// bindings of expired sessions.
+	SESSION_BIND_PRUNE_MIN = 1024
+)
+
+// Bind binds the session of specified token to specified principal, e.g. the
+// ID of a logged user. A session is bound to a single principal, and it keeps
+// its binding when rotated. When the principal would exceed its maximum
+// number of sessions (see WithMaxSessionsPerPrincipal), its oldest sessions
+// are deleted.
+//
+// The bindings of expired sessions are removed when the sessions of their
+// principals are listed, or when the number of bindings doubles.
+func (s *TypedSessionCache[T]) Bind(token, principal string) error {
+	if _, err := s.Get(token); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if current, ok := s.unsafeRotated(token); ok {
+		token = current
+	}
+	if s.bindings[token] == principal {
+		return nil
+	}
+	s.unbind(token)
+
+	tokens := s.validSessions(principal)
+	if s.maxPer > 0 {
+		for len(tokens) >= s.maxPer {
+			s.store.Delete(tokens[0])
+			delete(s.bindings, tokens[0])
+			s.dropCSRF(tokens[0])
+			tokens = tokens[1:]
+		}
+	}
+	s.principals[principal] = append(tokens, token)
+	s.bindings[token] = principal
+	if len(s.bindings) >= s.bindPrune {
+		s.pruneBindings()
+	}
+	return nil
+}
+
+// RevokeAll deletes every session bound to specified principal, e.g. when an
+// user changes its password. Returns the number of deleted sessions.
+func (s *TypedSessionCache[T]) RevokeAll(principal string) int {
+	s.Lock()
+	defer s.Unlock()
+
+	count := 0
+	for _, token := range s.principals[principal] {
+		if s.store.Delete(token) == nil {
+			count++
+		}
+		delete(s.bindings, token)
+		s.dropCSRF(token)
+	}
+	delete(s.principals, principal)
+	return count
+}
+
+// SessionsFor returns the tokens of valid sessions bound to specified
+// principal, oldest first.
+func (s *TypedSessionCache[T]) SessionsFor(principal string) []string {
+	s.Lock()
+	defer s.Unlock()
+
+	tokens := s.validSessions(principal)
+	result := make([]string, len(tokens))
+	copy(result, tokens)
+	return result
+}
+
+// exists returns whether specified token is stored, without postponing the
+// expiration of its session.
+func (s *TypedSessionCache[T]) exists(token string) bool {
+	_, err := s.store.TTL(token)
+	return err == nil
+}
+
+// pruneBindings removes the bindings of expired sessions of every principal,
+// and defers the next pruning until the number of bindings doubles. Must be
+// called with lock held.
+func (s *TypedSessionCache[T]) pruneBindings() {
+	for principal := range s.principals {
+		s.validSessions(principal)
+	}
+
+	s.bindPrune = 2 * len(s.bindings)
+	if s.bindPrune < SESSION_BIND_PRUNE_MIN {
+		s.bindPrune = SESSION_BIND_PRUNE_MIN
+	}
+}
+
+// rebind moves the binding of a rotated token to its replacement. Must be
+// called with lock held.
+func (s *TypedSessionCache[T]) rebind(oldToken, newToken string) {
+	principal, ok := s.bindings[oldToken]
+	if !ok {
+		return
+	}
+
+	delete(s.bindings, oldToken)
+	s.bindings[newToken] = principal
+	for i, token := range s.principals[principal] {
+		if token == oldToken {
+			s.principals[principal][i] = newToken
+		}
+	}
+}
+
+// unbind removes the binding of specified token, if any. Must be called with
+// lock held.
+func (s *TypedSessionCache[T]) unbind(token string) {
+	principal, ok := s.bindings[token]
+	if !ok {
+		return
+	}
+
+	delete(s.bindings, token)
+	tokens := s.principals[principal]
+	for i, t := range tokens {
+		if t == token {
+			tokens = append(tokens[:i:i], tokens[i+1:]...)
+			break
+		}
+	}
+	if len(tokens) == 0 {
+		delete(s.principals, principal)
+	} else {
+		s.principals[principal] = tokens
+	}
+}
+
+// validSessions removes expired sessions from the index of specified
+// principal and returns its remaining tokens. Must be called with lock held.
+func (s *TypedSessionCache[T]) validSessions(principal string) []string {
+	tokens := s.principals[principal]
+	valid := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if s.exists(token) {
+			valid = append(valid, token)
+		} else {
+			delete(s.bindings, token)
+		}
+	}
+
+	if len(valid) == 0 {
+		delete(s.principals, principal)
+	} else {
+		s.principals[principal] = valid
+	}
+	return valid
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2015 Fabrício Godoy
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package http
+
+// A SessionStore defines the operations used by SessionMiddleware to keep
+// sessions, which are identified by tokens sent to clients. The token of a
+// session could change when its value is saved, e.g. when the token holds the
+// session value itself.
+//
+// The expiration of sessions is postponed differently by each implementation:
+// SessionCache postpones it every time a session is read, while
+// CookieSessionStore only postpones it when a session is saved or renewed. The
+// stores that support renewal, like CookieSessionStore, have the sessions read
+// by SessionMiddleware renewed as they approach their expiration.
+type SessionStore interface {
+	// Delete deletes the session of specified token.
+	Delete(token string) error
+	// Get gets the value stored by the session of specified token.
+	Get(token string) (interface{}, error)
+	// Rotate moves the session of specified token to a new token, which is
+	// returned.
+	Rotate(token string) (string, error)
+	// Save stores specified value into the session of specified token, issuing
+	// a new session when the token is empty or invalid. Returns the token of
+	// the session.
+	Save(token string, value interface{}) (string, error)
+}
+
+// A csrfSessionStore defines a SessionStore that binds anti-CSRF tokens to its
+// sessions.
+type csrfSessionStore interface {
+	SessionStore
+	CSRFToken(token string) (string, error)
+	CheckCSRFToken(token, csrf string) bool
+}
+
+// A renewableSessionStore defines a SessionStore whose sessions are not
+// postponed when read, then they must be renewed to remain valid.
+type renewableSessionStore interface {
+	SessionStore
+	Renew(token string) (string, error)
+}
+
+var (
+	_ SessionStore     = (*SessionCache)(nil)
+	_ SessionStore     = (*CookieSessionStore)(nil)
+	_ csrfSessionStore = (*SessionCache)(nil)
+
+	_ renewableSessionStore = (*CookieSessionStore)(nil)
+)